@@ -0,0 +1,167 @@
+package irc
+
+import (
+	"strings"
+)
+
+// Away marks us as away with the message, automatic away is suspended
+// until Back is called
+func (c *Client) Away(message string) error {
+	c.awayMu.Lock()
+	c.away = true
+	c.autoAwayActive = false
+	c.awayMu.Unlock()
+
+	return c.Sendf("AWAY :%s", message)
+}
+
+// Back marks us as no longer away
+func (c *Client) Back() error {
+	c.awayMu.Lock()
+	c.away = false
+	c.autoAwayActive = false
+	c.awayMu.Unlock()
+
+	return c.Sendf("AWAY")
+}
+
+// touchAway is called for each line that is sent on behalf of the user, it
+// restarts the auto away timer and marks us as back if we were automatically
+// marked as away. The lines that the client sends on its own, such as PONGs,
+// nick reclaims and the registration, never get here so they don't count as
+// activity. PING, PONG and AWAY don't count even if the user sends them.
+func (c *Client) touchAway(line string) {
+	if c.autoAwayAfter == 0 {
+		return
+	}
+
+	p := strings.Fields(line)
+	if len(p) > 0 && strings.Index(p[0], tagPrefix) == 0 {
+		p = p[1:]
+	}
+	if len(p) > 0 {
+		switch strings.ToUpper(p[0]) {
+		case "PING", "PONG", "AWAY":
+			return
+		}
+	}
+
+	c.awayMu.Lock()
+	back := c.autoAwayActive
+	c.autoAwayActive = false
+	if c.awayTimer == nil {
+		c.awayTimer = c.clock.AfterFunc(c.autoAwayAfter, c.autoAway)
+	} else {
+		c.awayTimer.Reset(c.autoAwayAfter)
+	}
+	c.awayMu.Unlock()
+
+	if back {
+		c.send("AWAY")
+	}
+}
+
+// startAutoAway starts the auto away timer once we are registered, we are
+// never away on a new connection
+func (c *Client) startAutoAway() {
+	if c.autoAwayAfter == 0 {
+		return
+	}
+
+	c.awayMu.Lock()
+	c.autoAwayActive = false
+	if c.awayTimer == nil {
+		c.awayTimer = c.clock.AfterFunc(c.autoAwayAfter, c.autoAway)
+	} else {
+		c.awayTimer.Reset(c.autoAwayAfter)
+	}
+	c.awayMu.Unlock()
+}
+
+// autoAway marks us as away when there has been no activity for the
+// duration that was set with WithAutoAway
+func (c *Client) autoAway() {
+	c.awayMu.Lock()
+	if c.away || c.autoAwayActive {
+		c.awayMu.Unlock()
+		return
+	}
+	c.autoAwayActive = true
+	c.awayMu.Unlock()
+
+	c.send("AWAY :" + c.autoAwayMessage)
+}
+
+// stopAutoAway stops the auto away timer
+func (c *Client) stopAutoAway() {
+	c.awayMu.Lock()
+	if c.awayTimer != nil {
+		c.awayTimer.Stop()
+		c.awayTimer = nil
+	}
+	c.awayMu.Unlock()
+}
+
+// updateAway keeps track of the away status of other users, the server
+// tells us about changes when away-notify is enabled. The caller must hold
+// infoMu and the members must have been updated already.
+func (c *Client) updateAway(m *Message) {
+	switch m.Command {
+	case "AWAY":
+		// AWAY [:<message>], no message means that the user is back
+		if msg := m.Text(); msg != "" {
+			c.awayUsers[c.casefold(m.Name)] = msg
+		} else {
+			delete(c.awayUsers, c.casefold(m.Name))
+		}
+
+	case "301":
+		// RPL_AWAY, <me> <nick> :<message>
+		if len(m.ParamsArray) > 1 {
+			c.awayUsers[c.casefold(m.ParamsArray[1])] = m.Text()
+		}
+
+	case "NICK":
+		if len(m.ParamsArray) == 0 {
+			return
+		}
+		if msg, ok := c.awayUsers[c.casefold(m.Name)]; ok {
+			delete(c.awayUsers, c.casefold(m.Name))
+			c.awayUsers[c.casefold(strings.TrimPrefix(m.ParamsArray[0], prefix))] = msg
+		}
+
+	case "QUIT":
+		delete(c.awayUsers, c.casefold(m.Name))
+
+	case "PART", "KICK":
+		// Forget users that we no longer share a channel with since we
+		// won't hear about their status anymore
+		for nick := range c.awayUsers {
+			if !c.sharesChannel(nick) {
+				delete(c.awayUsers, nick)
+			}
+		}
+	}
+}
+
+// sharesChannel reports whether the casefolded nick is in any of the
+// channels that we are in, the caller must hold infoMu
+func (c *Client) sharesChannel(nick string) bool {
+	for _, ch := range c.members {
+		if _, ok := ch[nick]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAway reports whether the nick is away and returns the away message, this
+// relies on the away-notify capability to hear about changes for the users
+// that share a channel with us
+func (c *Client) IsAway(nick string) (bool, string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	msg, ok := c.awayUsers[c.casefold(nick)]
+	return ok, msg
+}
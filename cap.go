@@ -0,0 +1,167 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// Caps returns the capabilities that the server has acknowledged.
+//
+// Deprecated: use Capabilities instead.
+func (c *Client) Caps() []string {
+	return c.Capabilities()
+}
+
+// Capabilities returns the capabilities that the server has acknowledged,
+// sorted by name
+func (c *Client) Capabilities() []string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	caps := make([]string, 0, len(c.capsEnabled))
+	for name := range c.capsEnabled {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// HasCap reports whether the server has acknowledged the capability. A name
+// without a prefix also matches the draft and vendor prefixed versions of the
+// capability, e.g. chathistory matches draft/chathistory.
+func (c *Client) HasCap(name string) bool {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.hasCap(name)
+}
+
+// hasCap is HasCap for callers that hold infoMu
+func (c *Client) hasCap(name string) bool {
+	if c.capsEnabled[name] {
+		return true
+	}
+	if strings.Contains(name, "/") {
+		return false
+	}
+
+	for enabled := range c.capsEnabled {
+		if i := strings.LastIndex(enabled, "/"); i >= 0 && enabled[i+1:] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// capList returns the capabilities in a CAP message, the values of the
+// capabilities are kept
+func capList(m *Message) map[string]string {
+	caps := make(map[string]string)
+	for _, c := range strings.Fields(m.Text()) {
+		kv := strings.SplitN(c, "=", 2)
+		if len(kv) == 2 {
+			caps[kv[0]] = kv[1]
+		} else {
+			caps[kv[0]] = ""
+		}
+	}
+	return caps
+}
+
+// capSubcommand returns the subcommand of a CAP message
+func capSubcommand(m *Message) string {
+	// <target> <subcommand> [*] :<caps>
+	if len(m.ParamsArray) < 2 {
+		return ""
+	}
+	return m.ParamsArray[1]
+}
+
+// updateCaps updates the capability state from a CAP message, the caller
+// must hold infoMu
+func (c *Client) updateCaps(m *Message) {
+	caps := capList(m)
+
+	switch capSubcommand(m) {
+	case "LS", "NEW":
+		for name, value := range caps {
+			c.capsAvailable[name] = value
+		}
+
+	case "ACK":
+		for name := range caps {
+			if strings.HasPrefix(name, "-") {
+				delete(c.capsEnabled, name[1:])
+			} else {
+				c.capsEnabled[name] = true
+			}
+		}
+
+	case "DEL":
+		for name := range caps {
+			delete(c.capsAvailable, name)
+			delete(c.capsEnabled, name)
+		}
+	}
+}
+
+// handleCap requests the capabilities that we want when the server lists
+// them and ends the negotiation once the server has replied to our request
+func (c *Client) handleCap(m *Message) {
+	switch capSubcommand(m) {
+	case "LS":
+		// A * before the list means that there are more lines to
+		// come
+		if len(m.ParamsArray) > 2 && m.ParamsArray[2] == "*" {
+			return
+		}
+
+		if req := c.wantedCaps(); len(req) > 0 {
+			c.send("CAP REQ :" + strings.Join(req, " "))
+		} else {
+			c.capEnd()
+		}
+
+	case "NEW":
+		// Request newly available capabilities that we want
+		if req := c.wantedCaps(); len(req) > 0 {
+			c.send("CAP REQ :" + strings.Join(req, " "))
+		}
+
+	case "ACK":
+		// The negotiation continues with SASL if it was acknowledged
+		if !c.saslStart() {
+			c.capEnd()
+		}
+
+	case "NAK":
+		c.capEnd()
+	}
+}
+
+// defaultCaps contains the capabilities that we always want if they are
+// available, multi-prefix makes NAMES list all prefixes of each member and
+// userhost-in-names adds the user and host of each member
+var defaultCaps = []string{"cap-notify", "multi-prefix", "userhost-in-names"}
+
+// wantedCaps returns the capabilities that we want, that are available and
+// not yet enabled
+func (c *Client) wantedCaps() []string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	var req []string
+	for _, name := range append(append([]string{}, defaultCaps...), c.capWant...) {
+		if _, ok := c.capsAvailable[name]; ok && !c.capsEnabled[name] && indexOf(req, name) < 0 {
+			req = append(req, name)
+		}
+	}
+	return req
+}
+
+// capEnd ends the capability negotiation if we aren't registered yet
+func (c *Client) capEnd() {
+	if !c.Registered() {
+		c.send("CAP END")
+		c.setRegistrationState(RegistrationCapFinished)
+	}
+}
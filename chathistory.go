@@ -0,0 +1,146 @@
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serverTimeFormat is the format of the server-time tag and of the
+// timestamps that are used in CHATHISTORY requests
+const serverTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Time returns the time of the server-time tag, false is returned if the
+// message doesn't have the tag or if it can't be parsed
+func (m *Message) Time() (time.Time, bool) {
+	v, ok := m.Tags["time"]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ChatHistory requests the latest n messages of the target, the messages are
+// returned in chronological order. This requires the draft/chathistory,
+// batch and server-time capabilities. The messages aren't passed to the
+// event handlers.
+func (c *Client) ChatHistory(target string, n int) ([]*Message, error) {
+	return c.chatHistory("LATEST", target, "*", n)
+}
+
+// ChatHistoryBefore requests at most n messages of the target that were sent
+// before t, the messages are returned in chronological order
+func (c *Client) ChatHistoryBefore(target string, t time.Time, n int) ([]*Message, error) {
+	return c.chatHistory("BEFORE", target, "timestamp="+t.UTC().Format(serverTimeFormat), n)
+}
+
+// ChatHistoryAfter requests at most n messages of the target that were sent
+// after t, the messages are returned in chronological order
+func (c *Client) ChatHistoryAfter(target string, t time.Time, n int) ([]*Message, error) {
+	return c.chatHistory("AFTER", target, "timestamp="+t.UTC().Format(serverTimeFormat), n)
+}
+
+// chatHistory sends the CHATHISTORY request and collects the messages of
+// the batch that the server replies with
+func (c *Client) chatHistory(subcommand, target, ref string, n int) ([]*Message, error) {
+	// Register a waiter for the batch and for any failures, the batch
+	// reference isn't known until the batch starts so all batched
+	// messages are passed to us
+	w := c.wait(func(m *Message) bool {
+		if _, ok := m.Tags["batch"]; ok {
+			return true
+		}
+		return m.Command == "BATCH" ||
+			m.Command == "FAIL" && len(m.ParamsArray) > 0 && m.ParamsArray[0] == "CHATHISTORY"
+	})
+	defer c.stopWait(w)
+
+	if err := c.Sendf("CHATHISTORY %s %s %s %d", subcommand, target, ref, n); err != nil {
+		return nil, err
+	}
+
+	var batch string
+	var msgs []*Message
+	timeout := c.clock.After(replyTimeout)
+	for {
+		select {
+		case m := <-w.ch:
+			switch {
+			case m.Command == "FAIL":
+				if r, ok := parseStandardReply(m); ok {
+					return nil, fmt.Errorf("chathistory failed: %s %s", r.Code, r.Description)
+				}
+				return nil, fmt.Errorf("chathistory failed")
+
+			case m.Command == "BATCH" && batch == "":
+				// BATCH +<ref> chathistory <target>
+				p := m.ParamsArray
+				if len(p) >= 3 && strings.HasPrefix(p[0], "+") && p[1] == "chathistory" {
+					c.infoMu.Lock()
+					same := c.casefold(p[2]) == c.casefold(target)
+					c.infoMu.Unlock()
+
+					if same {
+						batch = p[0][1:]
+					}
+				}
+
+			case m.Command == "BATCH" && len(m.ParamsArray) > 0 && m.ParamsArray[0] == "-"+batch:
+				sort.SliceStable(msgs, func(i, j int) bool {
+					ti, _ := msgs[i].Time()
+					tj, _ := msgs[j].Time()
+					return ti.Before(tj)
+				})
+				return msgs, nil
+
+			case batch != "" && m.Tags["batch"] == batch:
+				msgs = append(msgs, m)
+			}
+
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for chathistory of %s", target)
+		}
+	}
+}
+
+// updateHistoryBatches keeps track of the chathistory batches that are
+// open, the caller must hold infoMu
+func (c *Client) updateHistoryBatches(m *Message) {
+	// BATCH +<ref> chathistory <target> or BATCH -<ref>
+	p := m.ParamsArray
+	switch {
+	case len(p) >= 2 && strings.HasPrefix(p[0], "+") && p[1] == "chathistory":
+		c.historyBatches[p[0][1:]] = true
+	case len(p) >= 1 && strings.HasPrefix(p[0], "-"):
+		delete(c.historyBatches, p[0][1:])
+	}
+}
+
+// isHistory returns true if the message belongs to an open chathistory
+// batch, the caller must hold infoMu
+func (c *Client) isHistory(m *Message) bool {
+	ref, ok := m.Tags["batch"]
+	return ok && c.historyBatches[ref]
+}
+
+// historyMiddleware keeps the messages of chathistory batches away from the
+// event handlers, they have been seen before and are only returned by
+// ChatHistory. Otherwise a bot would run old commands again.
+func (c *Client) historyMiddleware(next Handler) Handler {
+	return func(m *Message) {
+		c.infoMu.Lock()
+		history := c.isHistory(m)
+		c.infoMu.Unlock()
+
+		if history {
+			return
+		}
+		next(m)
+	}
+}
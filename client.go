@@ -1,12 +1,16 @@
 package irc
 
 import (
+	"bytes"
+	"crypto/tls"
 	"log"
 	"net"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/osm/event"
+	"golang.org/x/text/encoding"
 )
 
 type postConnectMessage struct {
@@ -16,45 +20,237 @@ type postConnectMessage struct {
 
 // Client contains the IRC client
 type Client struct {
-	// Connection and address
-	conn net.Conn
-	addr string
+	// Connection and address, connFactory is used instead of addr to
+	// create new connections if it is set. The connections to addr use TLS
+	// if tlsConfig is set.
+	conn        net.Conn
+	addr        string
+	connFactory func() (net.Conn, error)
+	tlsConfig   *tls.Config
+
+	// Writes to the connection are serialized by writeMu, if the flush
+	// interval is set the lines are buffered in writeBuf and written
+	// together when the buffer is flushed
+	writeMu       sync.Mutex
+	writeBuf      bytes.Buffer
+	flushInterval time.Duration
+	flushTimer    Timer
 
 	// Event hub
-	hub event.Hub
+	hub *Hub
+
+	// Middleware that wraps the dispatch of messages and transforms of the
+	// lines that are sent
+	middleware    []func(next Handler) Handler
+	outMiddleware []func(line string) string
+	middlewareMu  sync.Mutex
+
+	// Bot commands and the prefix that they start with
+	commands      map[string]func(ctx *CommandContext)
+	commandPrefix string
+	commandsMu    sync.Mutex
+
+	// Waiters for request/reply style commands
+	waiters waiters
 
 	// Logger
 	logger *log.Logger
 
+	// Source of the time, it is only replaced in tests
+	clock Clock
+
 	// Quit channel
-	// Send data on this channel to exit the main loop
+	// Send data on this channel to exit the main loop, it is buffered so
+	// that a quit can be requested before the loop is running
 	quit chan bool
 
+	// Reconnect channel
+	// Reconnect sends on this channel before it closes the connection so
+	// that the main loop knows that it should reconnect right away
+	reconnectReq chan bool
+
+	// Registration timeout channel
+	// The registration timeout sends on this channel before it closes the
+	// connection so that the main loop knows that it should reconnect
+	regTimeout          chan bool
+	registrationTimeout time.Duration
+
+	// The main loop signals on stopped when it ends because we quit, done
+	// is closed by Shutdown to stop the goroutines of the client
+	stopped   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// running is set to 1 while the main loop is running, quitting is set
+	// to 1 once Quit is about to send the QUIT and ended is set to 1 when
+	// Connect has returned. They are accessed atomically.
+	running  int32
+	quitting int32
+	ended    int32
+
 	// Client related variables
 	nick                string
 	user                string
 	realName            string
 	channels            []string
+	joined              []string
+	members             map[string]map[string]*member
+	awayUsers           map[string]string
+	namesCache          map[string]namesEntry
+	recentSends         map[string]time.Time
+	namesCacheTTL       time.Duration
 	version             string
 	currentNick         string
 	currentUser         string
 	currentHost         string
 	postConnectMessages []postConnectMessage
 	postConnectModes    []string
+	userModes           []string
+	userRegMode         int
+	registered          bool
+	connGen             int
+	autoReclaim         time.Duration
+	autoRejoin          bool
+	autoRejoinDelay     time.Duration
+	autoRejoinLimit     int
+	rejoins             map[string]rejoin
+	isupport            map[string]string
+	ignores             []string
+	netsplitWindow      time.Duration
+	netsplits           map[string]*netsplitBatch
+	netjoins            map[string]*netsplitBatch
+	splitNicks          map[string]splitNick
+	historyBatches      map[string]bool
+	joiningNicks        map[string]string
+	nickChangeFns       []func(old, new string)
+	disconnectFns       []func(reason string)
+	errorReason         string
+	nickServ            string
+	nickServPassword    string
+	nickServRegister    string
+	identifyRetries     map[string]bool
+	banLists            map[string][]Ban
+	banListFns          []func(channel string, bans []Ban)
+	pings               map[string]time.Time
+	lag                 time.Duration
+	silenced            []string
+	dccSendFns          []func(offer *DCCSend)
+	dccIP               net.IP
+	dccPortMin          int
+	dccPortMax          int
+	capWant             []string
+	capsAvailable       map[string]string
+	capsEnabled         map[string]bool
+	sasl                []saslMechanism
+	saslCandidates      []saslMechanism
+	saslCurrent         saslMechanism
+	saslIn              strings.Builder
+	saslErr             error
 	infoMu              sync.Mutex
 
+	// Registration steps that have been reported for this connection and
+	// the functions that they are reported to
+	regStates map[RegistrationState]bool
+	regFns    []func(state RegistrationState)
+	regMu     sync.Mutex
+
+	// Lines that are sent while we are disconnected are held in the send
+	// queue if the size is larger than zero
+	sendQueue           []queuedLine
+	sendQueueSize       int
+	sendQueueDropOldest bool
+	sendQueueMu         sync.Mutex
+
+	// Rate limit of the messages to each target, targetBuckets holds a
+	// token bucket for each target
+	targetMessages int
+	targetPer      time.Duration
+	targetBuckets  map[string]*bucket
+	targetMu       sync.Mutex
+
+	// Automatic away, we are marked as away when nothing has been sent
+	// for autoAwayAfter. away is set when Away has been called.
+	autoAwayAfter   time.Duration
+	autoAwayMessage string
+	autoAwayActive  bool
+	away            bool
+	awayTimer       Timer
+	awayMu          sync.Mutex
+
+	// Keys of the received messages that have been dispatched, they are
+	// kept across reconnects so that played back messages can be dropped
+	dedupWindow time.Duration
+	dedupSeen   map[string]time.Time
+	dedupPruned time.Time
+	dedupMu     sync.Mutex
+
+	// Ident responder, it is only started if the user is set
+	identUser string
+	identAddr string
+	identLn   net.Listener
+	identMu   sync.Mutex
+
+	// Addresses that are announced in a PROXY protocol header when we
+	// connect, no header is sent if they are empty
+	proxySrc string
+	proxyDst string
+
+	// Maximum line length without CR-LF, zero means that the default is
+	// used. The server line length is set from the LINELEN ISUPPORT token.
+	lineLength       int
+	serverLineLength int32
+
+	// Encoding of the server, nil means UTF-8 with a fallback to ISO8859-1
+	encoding encoding.Encoding
+
+	// Don't reply to PINGs from the server
+	noAutoPong bool
+
+	// Send lines that are too long as they are instead of truncating them
+	noTruncate bool
+
+	// Replace invalid UTF-8 in received messages
+	replaceInvalidUTF8 bool
+
 	// If this is true, all output will be logged
-	debug bool
+	debug   bool
+	debugMu sync.Mutex
 }
 
 // NewClient creates a new IRC client
 func NewClient(opts ...Option) *Client {
 	// Create a new client
 	c := &Client{
-		hub:     event.NewHub(),
-		logger:  log.New(os.Stdout, "IRC: ", log.LstdFlags),
-		quit:    make(chan bool),
-		version: "github.com/osm/irc",
+		hub:      NewHub(),
+		logger:   log.New(os.Stderr, "IRC: ", log.LstdFlags),
+		clock:    realClock{},
+		quit:     make(chan bool, 1),
+		isupport: make(map[string]string),
+
+		reconnectReq:    make(chan bool, 1),
+		regTimeout:      make(chan bool, 1),
+		stopped:         make(chan struct{}, 1),
+		done:            make(chan struct{}),
+		autoRejoinLimit: defaultAutoRejoinLimit,
+		rejoins:         make(map[string]rejoin),
+		members:         make(map[string]map[string]*member),
+		awayUsers:       make(map[string]string),
+		namesCache:      make(map[string]namesEntry),
+		recentSends:     make(map[string]time.Time),
+		dedupSeen:       make(map[string]time.Time),
+		netsplits:       make(map[string]*netsplitBatch),
+		netjoins:        make(map[string]*netsplitBatch),
+		splitNicks:      make(map[string]splitNick),
+		historyBatches:  make(map[string]bool),
+		joiningNicks:    make(map[string]string),
+		targetBuckets:   make(map[string]*bucket),
+		regStates:       make(map[RegistrationState]bool),
+		identifyRetries: make(map[string]bool),
+		banLists:        make(map[string][]Ban),
+		pings:           make(map[string]time.Time),
+		commands:        make(map[string]func(ctx *CommandContext)),
+		commandPrefix:   defaultCommandPrefix,
+		version:         "github.com/osm/irc",
 	}
 
 	// Apply all options
@@ -62,6 +258,18 @@ func NewClient(opts ...Option) *Client {
 		opt(c)
 	}
 
+	// Drop messages that have already been dispatched, if enabled
+	c.Use(c.dedupMiddleware)
+
+	// Keep the messages of chathistory batches away from the handlers
+	c.Use(c.historyMiddleware)
+
+	// Drop messages from ignored users before they reach the handlers
+	c.Use(c.ignoreMiddleware)
+
+	// Dispatch netsplits and netjoins as single messages, if enabled
+	c.Use(c.netsplitMiddleware)
+
 	// Attach all core event handlers
 	c.coreEvents()
 
@@ -2,11 +2,21 @@ package irc
 
 import (
 	"bufio"
+	"context"
+	"encoding/base64"
 	"fmt"
+	"log"
+	"net"
 	"net/textproto"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
 )
 
 // clientTest contains the structure of the test cases
@@ -24,6 +34,7 @@ var clientTests = []clientTest{
 		name:   "nick in use",
 		events: []string{"433"},
 		script: []string{
+			"CLI CAP LS 302",
 			"CLI USER bar * * :foo bar",
 			"CLI NICK foo",
 			"SRV :irc.example.net 433 * foo :Nickname already in use",
@@ -39,6 +50,7 @@ var clientTests = []clientTest{
 		name:   "ping pong",
 		events: []string{"PING"},
 		script: []string{
+			"CLI CAP LS 302",
 			"CLI USER bar * * :foo bar",
 			"CLI NICK foo",
 			"SRV PING :irc.example.net",
@@ -46,10 +58,23 @@ var clientTests = []clientTest{
 			"SRV ERROR :end of test",
 		},
 	},
+	{
+		name:   "ping pong with two tokens",
+		events: []string{"PING"},
+		script: []string{
+			"CLI CAP LS 302",
+			"CLI USER bar * * :foo bar",
+			"CLI NICK foo",
+			"SRV PING token1 token2",
+			"CLI PONG token1 token2",
+			"SRV ERROR :end of test",
+		},
+	},
 	{
 		name:   "ctcp version",
 		events: []string{"PRIVMSG"},
 		script: []string{
+			"CLI CAP LS 302",
 			"CLI USER bar * * :foo bar",
 			"CLI NICK foo",
 			"SRV :bar!bar@127.0.0.1 PRIVMSG foo :\x01VERSION\x01",
@@ -61,6 +86,7 @@ var clientTests = []clientTest{
 		name:   "reclaim nick",
 		events: []string{"433", "PING", "401"},
 		script: []string{
+			"CLI CAP LS 302",
 			"CLI USER bar * * :foo bar",
 			"CLI NICK foo",
 			"SRV :irc.example.net 433 * foo :Nickname already in use",
@@ -208,3 +234,1919 @@ func testClient(ct *clientTest, t *testing.T) {
 		}
 	}
 }
+
+// newTestClient creates a client that is connected to a mocked server, all
+// lines up until the NICK command are read from the server side before it
+// returns
+func newTestClient(opts ...Option) (*Client, *mockComm, *textproto.Reader) {
+	conn := newMockComm()
+	c := NewClient(append([]Option{WithConn(conn.Client), WithNick("foo")}, opts...)...)
+
+	go c.Connect()
+
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	for {
+		if l, err := tr.ReadLine(); err != nil || strings.HasPrefix(l, "NICK ") {
+			break
+		}
+	}
+
+	return c, conn, tr
+}
+
+// runScript runs a script against a client that was created by newTestClient,
+// SRV lines are sent to the client and CLI lines are expected from the client
+func runScript(t *testing.T, conn *mockComm, tr *textproto.Reader, script []string) {
+	for _, s := range script {
+		if s[0:3] == "SRV" {
+			fmt.Fprint(conn.Server, s[4:]+eol)
+			continue
+		}
+
+		if l, _ := tr.ReadLine(); l != s[4:] {
+			t.Errorf("client sent unexpected data to the server")
+			t.Logf("sent: %s", l)
+			t.Logf("expected: %s", s[4:])
+		}
+	}
+}
+
+// TestWhowas tests that the WHOWAS replies are aggregated
+func TestWhowas(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		entries []WhowasEntry
+		err     error
+	}
+	ch := make(chan result)
+	go func() {
+		e, err := c.Whowas("bar", 2)
+		ch <- result{e, err}
+	}()
+
+	if l, _ := tr.ReadLine(); l != "WHOWAS bar 2" {
+		t.Fatalf("client sent unexpected data to the server: %s", l)
+	}
+
+	fmt.Fprintf(conn.Server, ":irc.example.net 314 foo bar ~bar 127.0.0.1 * :bar baz"+eol)
+	fmt.Fprintf(conn.Server, ":irc.example.net 312 foo bar irc.example.net :Sat Oct 17 12:00:00 2026"+eol)
+	fmt.Fprintf(conn.Server, ":irc.example.net 314 foo bar ~bar 127.0.0.2 * :bar"+eol)
+	fmt.Fprintf(conn.Server, ":irc.example.net 369 foo bar :End of WHOWAS"+eol)
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+
+	expected := []WhowasEntry{
+		{Nick: "bar", User: "~bar", Host: "127.0.0.1", RealName: "bar baz", Server: "irc.example.net", SignedOff: "Sat Oct 17 12:00:00 2026"},
+		{Nick: "bar", User: "~bar", Host: "127.0.0.2", RealName: "bar"},
+	}
+	if !reflect.DeepEqual(r.entries, expected) {
+		t.Errorf("unexpected WHOWAS entries")
+		t.Logf("output: %#v", r.entries)
+		t.Logf("expected: %#v", expected)
+	}
+}
+
+// TestQuitBeforeConnect makes sure that Connect returns if Quit already has been called
+func TestQuitBeforeConnect(t *testing.T) {
+	c := NewClient(WithAddr("127.0.0.1:0"), WithNick("foo"))
+	c.Quit("bye")
+
+	done := make(chan error)
+	go func() {
+		done <- c.Connect()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Connect didn't return after Quit")
+	}
+}
+
+// TestQuitAfterConnect makes sure that a Quit after Connect has returned
+// doesn't end the next Connect
+func TestQuitAfterConnect(t *testing.T) {
+	conns := make(chan *mockComm, 2)
+	c := NewClient(WithNick("foo"), WithConnFactory(func() (net.Conn, error) {
+		conn := newMockComm()
+		conns <- conn
+		return conn.Client, nil
+	}))
+
+	done := make(chan error)
+	go func() { done <- c.Connect() }()
+	conn := <-conns
+	go func() {
+		// Close the connection like a server would after the QUIT
+		tr := textproto.NewReader(bufio.NewReader(conn.Server))
+		for {
+			if l, err := tr.ReadLine(); err != nil || l == "QUIT :bye" {
+				conn.Server.Close()
+				return
+			}
+		}
+	}()
+	c.Quit("bye")
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nothing is running, so the quit would be left for the next Connect
+	c.Quit("bye")
+
+	go func() { done <- c.Connect() }()
+	select {
+	case conn = <-conns:
+		defer conn.Server.Close()
+	case err := <-done:
+		t.Fatalf("Connect returned %v without connecting", err)
+	}
+
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	runScript(t, conn, tr, []string{
+		"CLI CAP LS 302",
+		"CLI USER foo * * :foo",
+		"CLI NICK foo",
+	})
+}
+
+// TestMiddleware makes sure that middleware is executed in registration order
+// and that it is able to drop messages
+func TestMiddleware(t *testing.T) {
+	c := NewClient()
+
+	var order []string
+	for _, name := range []string{"first", "second"} {
+		name := name
+		c.Use(func(next Handler) Handler {
+			return func(m *Message) {
+				order = append(order, name)
+				if m.Name != "ignored" {
+					next(m)
+				}
+			}
+		})
+	}
+
+	ch := make(chan *Message, 2)
+	c.Handle("PRIVMSG", func(m *Message) { ch <- m })
+
+	c.dispatch(&Message{Command: "PRIVMSG", Name: "ignored"})
+	c.dispatch(&Message{Command: "PRIVMSG", Name: "bar"})
+
+	if m := <-ch; m.Name != "bar" {
+		t.Errorf("expected message from bar, got %s", m.Name)
+	}
+	// The first middleware drops the first message, so the second
+	// middleware should only see the second message
+	if expected := []string{"first", "first", "second"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("middleware executed in unexpected order %v, expected %v", order, expected)
+	}
+}
+
+// TestIgnore makes sure that messages from ignored senders are dropped
+func TestIgnore(t *testing.T) {
+	c := NewClient()
+	c.Ignore("*!*@*.Example.com")
+
+	ch := make(chan *Message, 2)
+	c.Handle("PRIVMSG", func(m *Message) { ch <- m })
+
+	c.dispatch(&Message{Command: "PRIVMSG", Name: "foo", User: "foo", Host: "host.example.com"})
+	c.dispatch(&Message{Command: "PRIVMSG", Name: "bar", User: "bar", Host: "example.net"})
+
+	if m := <-ch; m.Name != "bar" {
+		t.Errorf("expected message from bar, got %s", m.Name)
+	}
+
+	// The message should go through once the mask is unignored
+	c.Unignore("*!*@*.Example.com")
+	c.dispatch(&Message{Command: "PRIVMSG", Name: "foo", User: "foo", Host: "host.example.com"})
+	if m := <-ch; m.Name != "foo" {
+		t.Errorf("expected message from foo, got %s", m.Name)
+	}
+}
+
+// TestNickChange makes sure that a confirmed change of our nick is reported
+func TestNickChange(t *testing.T) {
+	c, conn, _ := newTestClient()
+	defer conn.Server.Close()
+
+	ch := make(chan [2]string, 2)
+	c.OnNickChange(func(old, new string) { ch <- [2]string{old, new} })
+
+	// Someone else changing nick should not be reported
+	fmt.Fprintf(conn.Server, ":bar!bar@127.0.0.1 NICK :baz"+eol)
+	fmt.Fprintf(conn.Server, ":foo!foo@127.0.0.1 NICK :qux"+eol)
+
+	select {
+	case n := <-ch:
+		if n != [2]string{"foo", "qux"} {
+			t.Errorf("unexpected nick change %v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("nick change was not reported")
+	}
+
+	if nick := c.GetNick(); nick != "qux" {
+		t.Errorf("expected current nick to be qux, got %s", nick)
+	}
+	if nick := c.WantedNick(); nick != "foo" {
+		t.Errorf("expected wanted nick to be foo, got %s", nick)
+	}
+
+	select {
+	case n := <-ch:
+		t.Errorf("unexpected nick change %v", n)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestRegistered tests that we are registered once the server has sent 001
+// and that a new connection starts out unregistered
+func TestRegistered(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	if c.Registered() {
+		t.Errorf("registered before 001")
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 001 foo :Welcome",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+	if !c.Registered() {
+		t.Errorf("not registered after 001")
+	}
+
+	c.resetState()
+	if c.Registered() {
+		t.Errorf("still registered after the state was reset")
+	}
+}
+
+// TestKill tests the wire format of KILL
+func TestKill(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	go c.Kill("bar", "spamming")
+	runScript(t, conn, tr, []string{
+		"CLI KILL bar :spamming",
+	})
+}
+
+// TestChangeNick tests that a nick change waits for the confirmation and
+// that a refused change is returned as an error
+func TestChangeNick(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 001 foo :Welcome",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	errCh := make(chan error)
+	go func() { errCh <- c.ChangeNick("bar") }()
+	runScript(t, conn, tr, []string{
+		"CLI NICK bar",
+		"SRV :irc.example.net 433 foo bar :Nickname is already in use",
+	})
+	if err := <-errCh; err == nil {
+		t.Errorf("expected an error when the nick is in use")
+	}
+	if nick := c.WantedNick(); nick != "foo" {
+		t.Errorf("expected the wanted nick to still be foo, got %s", nick)
+	}
+
+	go func() { errCh <- c.ChangeNick("baz") }()
+	runScript(t, conn, tr, []string{
+		"CLI NICK baz",
+		"SRV :qux!~qux@127.0.0.1 NICK :baz",
+		"SRV :foo!~foo@127.0.0.1 NICK :baz",
+	})
+	if err := <-errCh; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.GetNick() != "baz" || c.WantedNick() != "baz" {
+		t.Errorf("expected the nick to be baz, got %s and %s", c.GetNick(), c.WantedNick())
+	}
+}
+
+// syncBuffer is a buffer that can be written to by several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestSetDebug tests that the logging can be toggled while we are connected
+func TestSetDebug(t *testing.T) {
+	var buf syncBuffer
+	c, conn, tr := newTestClient(WithLogger(log.New(&buf, "", 0)))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV PING :one",
+		"CLI PONG :one",
+	})
+	if c.Debug() || buf.String() != "" {
+		t.Fatalf("expected nothing to be logged, got %q", buf.String())
+	}
+
+	c.SetDebug(true)
+	runScript(t, conn, tr, []string{
+		"SRV PING :two",
+		"CLI PONG :two",
+	})
+	if !c.Debug() || !strings.Contains(buf.String(), "PING :two") || !strings.Contains(buf.String(), "PONG :two") {
+		t.Fatalf("expected the PING and PONG to be logged, got %q", buf.String())
+	}
+
+	c.SetDebug(false)
+	logged := buf.String()
+	runScript(t, conn, tr, []string{
+		"SRV PING :three",
+		"CLI PONG :three",
+	})
+	if c.Debug() || buf.String() != logged {
+		t.Errorf("expected nothing more to be logged, got %q", buf.String())
+	}
+}
+
+// TestRedactPasswords makes sure that the passwords that are sent to the
+// server are redacted from the debug log
+func TestRedactPasswords(t *testing.T) {
+	var buf syncBuffer
+	c, conn, tr := newTestClient(WithDebug(), WithLogger(log.New(&buf, "", 0)), WithNickServ("secret1"))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 001 foo :Welcome",
+		"CLI PRIVMSG NickServ :IDENTIFY secret1",
+	})
+
+	go c.Oper("foo", "secret2")
+	runScript(t, conn, tr, []string{"CLI OPER foo secret2"})
+
+	go c.Ghost("bar", "secret3")
+	runScript(t, conn, tr, []string{"CLI PRIVMSG NickServ :GHOST bar secret3"})
+
+	errCh := make(chan error)
+	go func() { errCh <- c.RegisterAccount("secret4", "foo@example.com") }()
+	runScript(t, conn, tr, []string{
+		"CLI PRIVMSG NickServ :REGISTER secret4 foo@example.com",
+		"SRV :NickServ!NickServ@services. NOTICE foo :Nickname foo registered.",
+	})
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var sent int
+	for _, l := range strings.Split(buf.String(), "\n") {
+		if !strings.HasPrefix(l, ">> ") {
+			continue
+		}
+		sent++
+		if strings.Contains(l, "secret") {
+			t.Errorf("password in the debug log: %s", l)
+		}
+	}
+	if sent == 0 {
+		t.Errorf("nothing was logged")
+	}
+}
+
+// TestRegisterAccount tests that the replies of Anope and Atheme are
+// recognized
+func TestRegisterAccount(t *testing.T) {
+	tests := []struct {
+		reply string
+		ok    bool
+	}{
+		// Anope
+		{"Nickname \x02foo\x02 registered.", true},
+		{"Nickname \x02foo\x02 is already registered!", false},
+		{"You must have been using this nick for at least 30 seconds to register.", false},
+		{"\x02bad\x02 is not a valid e-mail address.", false},
+
+		// Atheme
+		{"\x02foo\x02 is now registered to \x02foo@example.com\x02, you must confirm your email address.", true},
+		{"\x02foo\x02 is already registered.", false},
+		{"You cannot use your nickname as a password.", false},
+	}
+
+	for _, tt := range tests {
+		c, conn, tr := newTestClient()
+
+		errCh := make(chan error)
+		go func() { errCh <- c.RegisterAccount("secret", "foo@example.com") }()
+		runScript(t, conn, tr, []string{
+			"CLI PRIVMSG NickServ :REGISTER secret foo@example.com",
+			"SRV :NickServ!NickServ@services. NOTICE foo :" + tt.reply,
+		})
+		if err := <-errCh; (err == nil) != tt.ok {
+			t.Errorf("%q: unexpected error %v", tt.reply, err)
+		}
+		conn.Server.Close()
+	}
+}
+
+// TestNeedRegisteredNick makes sure that we identify and retry the join on 477
+func TestNeedRegisteredNick(t *testing.T) {
+	c, conn, tr := newTestClient(WithNickServ("secret"))
+	defer conn.Server.Close()
+
+	// Writes to the mocked connection blocks until they are read
+	go c.Sendf("JOIN #foo")
+	tr.ReadLine()
+
+	script := []string{
+		"SRV :irc.example.net 477 foo #foo :Cannot join channel (+r) - you need to be identified",
+		"CLI PRIVMSG NickServ :IDENTIFY secret",
+		"SRV :irc.example.net 900 foo foo!foo@127.0.0.1 foo :You are now logged in as foo",
+		"CLI JOIN #foo",
+		"SRV :irc.example.net 477 foo #foo :Cannot join channel (+r) - you need to be identified",
+		"CLI PRIVMSG #foo :we should only retry once",
+	}
+	for _, s := range script {
+		if s[0:3] == "SRV" {
+			fmt.Fprint(conn.Server, s[4:]+eol)
+			continue
+		}
+
+		// Give the client a chance to retry before we send the
+		// next message
+		if strings.HasSuffix(s, "once") {
+			time.Sleep(100 * time.Millisecond)
+			go c.Privmsg("#foo", "we should only retry once")
+		}
+
+		if l, _ := tr.ReadLine(); l != s[4:] {
+			t.Errorf("client sent unexpected data to the server")
+			t.Logf("sent: %s", l)
+			t.Logf("expected: %s", s[4:])
+		}
+	}
+}
+
+// TestBanList tests that the ban list is collected and that missing privileges are reported
+func TestBanList(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		bans []Ban
+		err  error
+	}
+	ch := make(chan result)
+	go func() {
+		b, err := c.BanList("#foo")
+		ch <- result{b, err}
+	}()
+
+	tr.ReadLine()
+	fmt.Fprintf(conn.Server, ":irc.example.net 367 foo #foo *!*@example.com bar!bar@127.0.0.1 1791028800"+eol)
+	fmt.Fprintf(conn.Server, ":irc.example.net 367 foo #foo baz!*@*"+eol)
+	fmt.Fprintf(conn.Server, ":irc.example.net 368 foo #foo :End of channel ban list"+eol)
+
+	r := <-ch
+	expected := []Ban{
+		{Channel: "#foo", Mask: "*!*@example.com", SetBy: "bar!bar@127.0.0.1", SetAt: time.Unix(1791028800, 0)},
+		{Channel: "#foo", Mask: "baz!*@*"},
+	}
+	if r.err != nil || !reflect.DeepEqual(r.bans, expected) {
+		t.Errorf("unexpected ban list %#v (%v)", r.bans, r.err)
+	}
+
+	go func() {
+		b, err := c.BanList("#bar")
+		ch <- result{b, err}
+	}()
+
+	tr.ReadLine()
+	fmt.Fprintf(conn.Server, ":irc.example.net 482 foo #bar :You're not a channel operator"+eol)
+
+	if r := <-ch; r.err == nil {
+		t.Errorf("expected an error when we lack privileges")
+	}
+}
+
+// TestEncoding tests that lines are converted to and from the server encoding
+func TestEncoding(t *testing.T) {
+	c, conn, tr := newTestClient(WithEncoding(charmap.ISO8859_1))
+	defer conn.Server.Close()
+
+	ch := make(chan *Message)
+	c.Handle("PRIVMSG", func(m *Message) { ch <- m })
+
+	fmt.Fprintf(conn.Server, ":bar!bar@127.0.0.1 PRIVMSG foo :r\xe4ksm\xf6rg\xe5s"+eol)
+	if m := <-ch; m.Text() != "räksmörgås" {
+		t.Errorf("expected räksmörgås, got %s", m.Text())
+	}
+
+	go c.Privmsg("bar", "räksmörgås")
+	if l, _ := tr.ReadLine(); l != "PRIVMSG bar :r\xe4ksm\xf6rg\xe5s" {
+		t.Errorf("unexpected line %q", l)
+	}
+}
+
+// TestReplaceInvalidUTF8 tests that invalid UTF-8 is replaced in the parsed message
+func TestReplaceInvalidUTF8(t *testing.T) {
+	c, conn, _ := newTestClient(WithReplaceInvalidUTF8())
+	defer conn.Server.Close()
+
+	ch := make(chan *Message)
+	c.Handle("PRIVMSG", func(m *Message) { ch <- m })
+
+	raw := ":bar!bar@127.0.0.1 PRIVMSG foo :foo\xff\xfebar"
+	fmt.Fprintf(conn.Server, raw+eol)
+
+	m := <-ch
+	if !utf8.ValidString(m.Text()) || m.Text() != "foo�bar" {
+		t.Errorf("expected foo�bar, got %q", m.Text())
+	}
+	if m.Raw != raw {
+		t.Errorf("raw message should be kept as is, got %q", m.Raw)
+	}
+}
+
+// TestCapabilities tests the capability negotiation and cap-notify
+func TestCapabilities(t *testing.T) {
+	c, conn, tr := newTestClient(WithCapabilities("server-time", "away-notify", "account-tag"))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS * :cap-notify server-time",
+		"SRV :irc.example.net CAP * LS :sasl=PLAIN away-notify",
+		"CLI CAP REQ :cap-notify server-time away-notify",
+		"SRV :irc.example.net CAP foo ACK :cap-notify server-time away-notify",
+		"CLI CAP END",
+		"SRV :irc.example.net 001 foo :Welcome",
+		"SRV :irc.example.net CAP foo NEW :account-tag batch",
+		"CLI CAP REQ :account-tag",
+		"SRV :irc.example.net CAP foo ACK :account-tag",
+		"SRV :irc.example.net CAP foo DEL :away-notify",
+		"SRV PING :irc.example.net",
+		"CLI PONG :irc.example.net",
+	})
+
+	expected := []string{"account-tag", "cap-notify", "server-time"}
+	if caps := c.Capabilities(); !reflect.DeepEqual(caps, expected) {
+		t.Errorf("expected capabilities %v, got %v", expected, caps)
+	}
+}
+
+// TestHasCap tests the lookup of capabilities with and without prefixes
+func TestHasCap(t *testing.T) {
+	c, conn, tr := newTestClient(WithCapabilities("server-time", "draft/chathistory", "znc.in/self-message"))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS :server-time draft/chathistory znc.in/self-message",
+		"CLI CAP REQ :server-time draft/chathistory znc.in/self-message",
+		"SRV :irc.example.net CAP foo ACK :server-time draft/chathistory znc.in/self-message",
+		"CLI CAP END",
+	})
+
+	for name, want := range map[string]bool{
+		"server-time":         true,
+		"chathistory":         true,
+		"draft/chathistory":   true,
+		"self-message":        true,
+		"znc.in/self-message": true,
+		"draft/server-time":   false,
+		"sasl":                false,
+	} {
+		if c.HasCap(name) != want {
+			t.Errorf("HasCap(%q) = %v, expected %v", name, !want, want)
+		}
+	}
+}
+
+// TestSASLChunks tests that long SASL payloads are split into chunks
+func TestSASLChunks(t *testing.T) {
+	// The payload is foo\0foo\0<password>, which is 600 bytes and 800
+	// bytes when it is base64 encoded
+	password := strings.Repeat("x", 592)
+	encoded := base64.StdEncoding.EncodeToString([]byte("foo\x00foo\x00" + password))
+
+	_, conn, tr := newTestClient(WithSASL("foo", password))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS :sasl",
+		"CLI CAP REQ :sasl",
+		"SRV :irc.example.net CAP foo ACK :sasl",
+		"CLI AUTHENTICATE PLAIN",
+		"SRV AUTHENTICATE +",
+		"CLI AUTHENTICATE " + encoded[:400],
+		"CLI AUTHENTICATE " + encoded[400:],
+		"CLI AUTHENTICATE +",
+		"SRV :irc.example.net 903 foo :SASL authentication successful",
+		"CLI CAP END",
+	})
+}
+
+// TestSASLMechanismFallback tests that the next mechanism is tried when one fails
+func TestSASLMechanismFallback(t *testing.T) {
+	c, conn, tr := newTestClient(WithSASL("foo", "bar"), WithSASLExternal())
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS :sasl=EXTERNAL,PLAIN,SCRAM-SHA-256",
+		"CLI CAP REQ :sasl",
+		"SRV :irc.example.net CAP foo ACK :sasl",
+		"CLI AUTHENTICATE EXTERNAL",
+		"SRV AUTHENTICATE +",
+		"CLI AUTHENTICATE +",
+		"SRV :irc.example.net 904 foo :SASL authentication failed",
+		"CLI AUTHENTICATE PLAIN",
+		"SRV AUTHENTICATE +",
+		"CLI AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("foo\x00foo\x00bar")),
+		"SRV :irc.example.net 903 foo :SASL authentication successful",
+		"CLI CAP END",
+	})
+
+	if mech := c.SASLMechanism(); mech != "PLAIN" {
+		t.Errorf("expected PLAIN to be used, got %s", mech)
+	}
+}
+
+// TestSASLUnsupported tests that the negotiation ends right away when the
+// server doesn't support any of the configured mechanisms
+func TestSASLUnsupported(t *testing.T) {
+	c, conn, tr := newTestClient(WithSASL("foo", "bar"))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS :sasl=EXTERNAL",
+		"CLI CAP REQ :sasl",
+		"SRV :irc.example.net CAP foo ACK :sasl",
+		"CLI CAP END",
+	})
+
+	if err := c.SASLError(); err != ErrSASLUnsupported {
+		t.Errorf("expected ErrSASLUnsupported, got %v", err)
+	}
+	if mech := c.SASLMechanism(); mech != "" {
+		t.Errorf("expected no mechanism to be used, got %s", mech)
+	}
+}
+
+// TestChatHistory makes sure that the messages of a chathistory batch are
+// collected and returned in chronological order
+func TestChatHistory(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		msgs []*Message
+		err  error
+	}
+	ch := make(chan result)
+	go func() {
+		msgs, err := c.ChatHistory("#foo", 2)
+		ch <- result{msgs, err}
+	}()
+
+	runScript(t, conn, tr, []string{
+		"CLI CHATHISTORY LATEST #foo * 2",
+		"SRV :irc.example.net BATCH +abc chathistory #foo",
+		"SRV @batch=abc;time=2026-10-17T12:00:01.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :second",
+		"SRV @batch=abc;time=2026-10-17T12:00:00.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :first",
+		"SRV @batch=xyz :bar!~bar@127.0.0.1 PRIVMSG #bar :other",
+		"SRV :irc.example.net BATCH -abc",
+	})
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+	if len(r.msgs) != 2 || r.msgs[0].Text() != "first" || r.msgs[1].Text() != "second" {
+		t.Errorf("unexpected messages: %#v", r.msgs)
+	}
+}
+
+// TestChatHistoryNotDispatched makes sure that the messages of a chathistory
+// batch aren't passed to the event handlers, so old commands aren't run again
+func TestChatHistoryNotDispatched(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	texts := make(chan string, 10)
+	c.OnPrivmsg(func(from, target, text string, isPrivate bool) {
+		texts <- text
+	})
+	c.Command("echo", func(ctx *CommandContext) {
+		ctx.Reply(strings.Join(ctx.Args, " "))
+	})
+
+	ch := make(chan error)
+	go func() {
+		_, err := c.ChatHistory("#foo", 1)
+		ch <- err
+	}()
+
+	runScript(t, conn, tr, []string{
+		"CLI CHATHISTORY LATEST #foo * 1",
+		"SRV :irc.example.net BATCH +abc chathistory #foo",
+		"SRV @batch=abc;time=2026-10-17T12:00:00.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :!echo old",
+		"SRV :irc.example.net BATCH -abc",
+	})
+	if err := <-ch; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :!echo new",
+		"CLI PRIVMSG #foo :new",
+	})
+
+	select {
+	case text := <-texts:
+		if text != "!echo new" {
+			t.Errorf("got %q, expected %q", text, "!echo new")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the new message wasn't dispatched")
+	}
+
+	select {
+	case text := <-texts:
+		t.Errorf("unexpected message %q", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestWildcardOrder makes sure that the wildcard handlers have returned before
+// the handlers of the command are called
+func TestWildcardOrder(t *testing.T) {
+	c := NewClient()
+
+	var mu sync.Mutex
+	var order []string
+	c.Handle("*", func(m *Message) {
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		order = append(order, "*")
+		mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	c.Handle("PRIVMSG", func(m *Message) {
+		mu.Lock()
+		order = append(order, "PRIVMSG")
+		mu.Unlock()
+		close(done)
+	})
+
+	c.dispatch(&Message{Command: "PRIVMSG"})
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"*", "PRIVMSG"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("handlers executed in unexpected order %v, expected %v", order, expected)
+	}
+}
+
+// TestConnLost makes sure that a client that was given a connection with
+// WithConn gives up when the connection is lost and that WithConnFactory is
+// used to create the connection
+func TestConnLost(t *testing.T) {
+	conn := newMockComm()
+	c := NewClient(WithNick("foo"), WithConnFactory(func() (net.Conn, error) {
+		return conn.Client, nil
+	}))
+
+	go c.Connect()
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	tr.ReadLine()
+	if l, _ := tr.ReadLine(); l != "USER foo * * :foo" {
+		t.Errorf("unexpected data sent to the server %s", l)
+	}
+	tr.ReadLine()
+	conn.Client.Close()
+
+	conn = newMockComm()
+	c = NewClient(WithNick("foo"), WithConn(conn.Client))
+
+	errCh := make(chan error)
+	go func() { errCh <- c.Connect() }()
+	tr = textproto.NewReader(bufio.NewReader(conn.Server))
+	tr.ReadLine()
+	tr.ReadLine()
+	tr.ReadLine()
+	conn.Server.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Errorf("expected an error when the connection is lost")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the client should give up when the connection is lost")
+	}
+}
+
+// TestOnJoinPartQuit tests the typed JOIN, PART and QUIT callbacks, with and
+// without extended-join
+func TestOnJoinPartQuit(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	events := make(chan string, 10)
+	c.OnJoin(func(nick, channel, account, realname string) {
+		events <- fmt.Sprintf("join %s %s %q %q", nick, channel, account, realname)
+	})
+	c.OnPart(func(nick, channel, reason string) {
+		events <- fmt.Sprintf("part %s %s %q", nick, channel, reason)
+	})
+	c.OnQuit(func(nick, reason string) {
+		events <- fmt.Sprintf("quit %s %q", nick, reason)
+	})
+
+	script := []string{
+		"SRV :bar!~bar@127.0.0.1 JOIN :#foo",
+		"SRV :baz!~baz@127.0.0.1 JOIN #foo baz :Baz Qux",
+		"SRV :qux!~qux@127.0.0.1 JOIN #foo * :Qux",
+		"SRV :bar!~bar@127.0.0.1 PART #foo",
+		"SRV :baz!~baz@127.0.0.1 PART #foo :see you",
+		"SRV :qux!~qux@127.0.0.1 QUIT :Quit: bye",
+	}
+	expected := []string{
+		`join bar #foo "" ""`,
+		`join baz #foo "baz" "Baz Qux"`,
+		`join qux #foo "" "Qux"`,
+		`part bar #foo ""`,
+		`part baz #foo "see you"`,
+		`quit qux "Quit: bye"`,
+	}
+
+	// The handlers run concurrently, so each line is sent once the
+	// previous one has been handled
+	for i, line := range script {
+		runScript(t, conn, tr, []string{line})
+		select {
+		case e := <-events:
+			if e != expected[i] {
+				t.Errorf("got %s, expected %s", e, expected[i])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event for %s", line)
+		}
+	}
+}
+
+// TestOnPrivmsg tests that channel and private messages are told apart and
+// that CTCP messages are left out
+func TestOnPrivmsg(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	events := make(chan string, 10)
+	c.OnPrivmsg(func(from, target, text string, isPrivate bool) {
+		events <- fmt.Sprintf("%s %s %q %v", from, target, text, isPrivate)
+	})
+
+	script := []string{
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :hello there",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :\x01ACTION waves\x01",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG FOO :psst",
+	}
+	runScript(t, conn, tr, append(script, "SRV PING :sync", "CLI PONG :sync"))
+
+	received := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-events:
+			received[e] = true
+		case <-time.After(time.Second):
+			t.Fatalf("expected two messages, got %v", received)
+		}
+	}
+
+	expected := map[string]bool{
+		`bar #foo "hello there" false`: true,
+		`bar FOO "psst" true`:          true,
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("got %v, expected %v", received, expected)
+	}
+
+	select {
+	case e := <-events:
+		t.Errorf("unexpected message %s", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestUseOut tests that the outgoing transforms are applied in order before
+// the line is truncated
+func TestUseOut(t *testing.T) {
+	c, conn, tr := newTestClient(WithMaxLineLength(128))
+	defer conn.Server.Close()
+
+	c.UseOut(func(line string) string {
+		return strings.Replace(line, "darn", "****", -1)
+	})
+	c.UseOut(func(line string) string {
+		if strings.HasPrefix(line, "PRIVMSG ") {
+			return line + " -- foo"
+		}
+		return line
+	})
+
+	go func() {
+		c.Privmsg("#foo", "darn it")
+		c.SendRaw("PRIVMSG #foo :" + strings.Repeat("a", 120))
+		c.SendRaw("PING :darn")
+	}()
+	runScript(t, conn, tr, []string{
+		"CLI PRIVMSG #foo :**** it -- foo",
+		"CLI PRIVMSG #foo :" + strings.Repeat("a", 114),
+		"CLI PING :****",
+	})
+}
+
+// TestOnDisconnect tests that the reason of an ERROR is reported when the
+// server closes the connection
+func TestOnDisconnect(t *testing.T) {
+	for _, tt := range []struct {
+		script []string
+		reason string
+	}{
+		{[]string{"SRV ERROR :Closing Link: foo (K-Lined)"}, "Closing Link: foo (K-Lined)"},
+		{nil, "EOF"},
+	} {
+		c, conn, tr := newTestClient()
+		reasons := make(chan string, 1)
+		c.OnDisconnect(func(reason string) { reasons <- reason })
+
+		runScript(t, conn, tr, append(tt.script, "SRV PING :sync", "CLI PONG :sync"))
+		conn.Server.Close()
+
+		select {
+		case r := <-reasons:
+			if r != tt.reason {
+				t.Errorf("got reason %q, expected %q", r, tt.reason)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("the disconnect wasn't reported")
+		}
+	}
+}
+
+// TestUserRegMode tests the mode bitmask of the USER command
+func TestUserRegMode(t *testing.T) {
+	for mask, expected := range map[int]string{0: "USER foo * * :foo", 8: "USER foo 8 * :foo"} {
+		conn := newMockComm()
+		c := NewClient(WithConn(conn.Client), WithNick("foo"), WithUserRegMode(mask))
+		go c.Connect()
+
+		tr := textproto.NewReader(bufio.NewReader(conn.Server))
+		tr.ReadLine()
+		if l, _ := tr.ReadLine(); l != expected {
+			t.Errorf("got %q, expected %q", l, expected)
+		}
+		conn.Server.Close()
+	}
+}
+
+// TestQuitDuringReconnect makes sure that a quit ends the wait before a
+// reconnect attempt
+func TestQuitDuringReconnect(t *testing.T) {
+	conn := newMockComm()
+	var n int32
+	c := NewClient(WithNick("foo"), WithConnFactory(func() (net.Conn, error) {
+		atomic.AddInt32(&n, 1)
+		return conn.Client, nil
+	}))
+
+	errCh := make(chan error)
+	go func() { errCh <- c.Connect() }()
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	tr.ReadLine()
+	tr.ReadLine()
+	tr.ReadLine()
+	conn.Server.Close()
+
+	// Give the client time to start waiting before the next attempt
+	time.Sleep(50 * time.Millisecond)
+	c.Quit("bye")
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("quit didn't end the wait for the reconnect")
+	}
+	if n := atomic.LoadInt32(&n); n != 1 {
+		t.Errorf("expected 1 connection attempt, got %d", n)
+	}
+}
+
+// TestReconnect makes sure that Reconnect replaces the connection right away
+func TestReconnect(t *testing.T) {
+	conns := []*mockComm{newMockComm(), newMockComm()}
+	var n int
+	c := NewClient(WithNick("foo"), WithConnFactory(func() (net.Conn, error) {
+		if n == len(conns) {
+			return nil, fmt.Errorf("no more connections")
+		}
+		conn := conns[n].Client
+		n++
+		return conn, nil
+	}))
+
+	go c.Connect()
+	for _, conn := range conns {
+		defer conn.Server.Close()
+	}
+
+	tr := textproto.NewReader(bufio.NewReader(conns[0].Server))
+	tr.ReadLine()
+	tr.ReadLine()
+	tr.ReadLine()
+
+	if err := c.Reconnect(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tr = textproto.NewReader(bufio.NewReader(conns[1].Server))
+	runScript(t, conns[1], tr, []string{
+		"CLI CAP LS 302",
+		"CLI USER foo * * :foo",
+		"CLI NICK foo",
+	})
+}
+
+// TestRenameChannel tests the wire format of RENAME and that the channel is
+// renamed in the list of channels
+func TestRenameChannel(t *testing.T) {
+	c, conn, tr := newTestClient(WithCapabilities("draft/channel-rename"))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS :draft/channel-rename",
+		"CLI CAP REQ :draft/channel-rename",
+		"SRV :irc.example.net CAP foo ACK :draft/channel-rename",
+		"CLI CAP END",
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+	})
+
+	go c.RenameChannel("#foo", "#bar", "new name")
+	runScript(t, conn, tr, []string{
+		"CLI RENAME #foo #bar :new name",
+		"SRV :foo!~foo@127.0.0.1 RENAME #foo #bar :new name",
+		"SRV :foo!~foo@127.0.0.1 PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if channels := c.Channels(); !reflect.DeepEqual(channels, []string{"#bar"}) {
+		t.Errorf("expected to be in #bar, got %v", channels)
+	}
+}
+
+// TestChannelsCaseMapping makes sure that our JOIN and PART are recognized
+// when the server echoes our nick in a different case, and that channel
+// names are compared with the case mapping of the server
+func TestChannelsCaseMapping(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 005 foo CASEMAPPING=rfc1459 :are supported by this server",
+		"SRV :FOO!~foo@127.0.0.1 JOIN #foo[1]",
+		"SRV :FOO!~foo@127.0.0.1 JOIN #bar",
+		"SRV :Foo!~foo@127.0.0.1 PART #FOO{1}",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if channels := c.Channels(); !reflect.DeepEqual(channels, []string{"#bar"}) {
+		t.Errorf("expected to be in #bar, got %v", channels)
+	}
+	if members := c.ChannelMembers("#BAR"); !reflect.DeepEqual(members, map[string]string{"FOO": ""}) {
+		t.Errorf("unexpected members of #bar %v", members)
+	}
+}
+
+// TestWatch makes sure that MONITOR is preferred over WATCH and that the
+// presence notifications of both are reported
+func TestWatch(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	ch := make(chan string, 4)
+	c.OnPresence(func(nick string, online bool) {
+		ch <- fmt.Sprintf("%s %v", nick, online)
+	})
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 005 foo WATCH=128 :are supported by this server",
+		"SRV :irc.example.net PING :sync",
+		"CLI PONG :sync",
+	})
+	if isupport := c.ISupport(); !reflect.DeepEqual(isupport, map[string]string{"WATCH": "128"}) {
+		t.Errorf("unexpected ISUPPORT tokens %v", isupport)
+	}
+	if network := c.Network(); network != "" {
+		t.Errorf("expected no network name, got %s", network)
+	}
+	go c.Watch("bar", "baz")
+	runScript(t, conn, tr, []string{
+		"CLI WATCH +bar +baz",
+		"SRV :irc.example.net 604 foo bar ~bar 127.0.0.1 1700000000 :is online",
+		"SRV :irc.example.net 605 foo baz * * 0 :is offline",
+		"SRV :irc.example.net 005 foo MONITOR=100 :are supported by this server",
+		"SRV :irc.example.net PING :sync",
+		"CLI PONG :sync",
+	})
+	go c.Watch("qux")
+	runScript(t, conn, tr, []string{
+		"CLI MONITOR + qux",
+		"SRV :irc.example.net 730 foo :qux!~qux@127.0.0.1",
+		"SRV :irc.example.net 731 foo :bar",
+	})
+
+	got := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		select {
+		case s := <-ch:
+			got[s] = true
+		case <-time.After(time.Second):
+			t.Fatalf("missing presence notifications, got %v", got)
+		}
+	}
+	for _, s := range []string{"bar true", "baz false", "qux true", "bar false"} {
+		if !got[s] {
+			t.Errorf("expected notification %s, got %v", s, got)
+		}
+	}
+}
+
+// TestAutoRejoin makes sure that we rejoin after a kick and that we give up
+// after too many kicks in a row
+func TestAutoRejoin(t *testing.T) {
+	_, conn, tr := newTestClient(WithAutoRejoin(true, 0), WithAutoRejoinLimit(1))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :bar!~bar@127.0.0.1 KICK #foo bar :not us",
+		"SRV :bar!~bar@127.0.0.1 KICK #foo foo :go away",
+		"CLI JOIN #foo",
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :bar!~bar@127.0.0.1 KICK #foo foo :go away",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+}
+
+// TestJoinWait tests that a successful join and a refused join are reported
+func TestJoinWait(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	failed := make(chan *JoinError, 1)
+	c.OnJoinFailed(func(err *JoinError) { failed <- err })
+
+	ch := make(chan error)
+	go func() { ch <- c.JoinWait("#foo", time.Second) }()
+	runScript(t, conn, tr, []string{
+		"CLI JOIN #foo",
+		"SRV :foo!~foo@127.0.0.1 JOIN :#foo",
+	})
+	if err := <-ch; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	go func() { ch <- c.JoinWait("#bar", time.Second) }()
+	runScript(t, conn, tr, []string{
+		"CLI JOIN #bar",
+		"SRV :irc.example.net 474 foo #bar :Cannot join channel (+b)",
+	})
+	err, ok := (<-ch).(*JoinError)
+	if !ok || err.Channel != "#bar" || err.Code != "474" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-failed:
+		if err.Channel != "#bar" || err.Code != "474" {
+			t.Errorf("unexpected join failure: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("join failure was not reported")
+	}
+}
+
+// TestMaxLineLength makes sure that messages are split to fit the configured
+// line length
+func TestMaxLineLength(t *testing.T) {
+	c, conn, tr := newTestClient(WithMaxLineLength(150))
+	defer conn.Server.Close()
+
+	go c.Privmsg("#foo", strings.Repeat("word ", 40))
+
+	var words int
+	for words < 40 {
+		l, err := tr.ReadLine()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(l) > 150 {
+			t.Errorf("line is %d bytes, expected at most 150", len(l))
+		}
+		if !strings.HasPrefix(l, "PRIVMSG #foo :") {
+			t.Fatalf("unexpected line %s", l)
+		}
+		words += len(strings.Fields(l)) - 2
+	}
+}
+
+// TestSendAndWait tests that the matching reply is returned and that an
+// error is returned when no reply arrives in time
+func TestSendAndWait(t *testing.T) {
+	clock := newFakeClock()
+	c, conn, tr := newTestClient(WithClock(clock))
+	defer conn.Server.Close()
+
+	type result struct {
+		m   *Message
+		err error
+	}
+	ch := make(chan result)
+	whois := func(nick string) {
+		m, err := c.SendAndWait("WHOIS "+nick, func(m *Message) bool {
+			return m.Command == "318"
+		}, time.Second)
+		ch <- result{m, err}
+	}
+
+	go whois("baz")
+	runScript(t, conn, tr, []string{"CLI WHOIS baz"})
+	waitForWaiters(t, clock)
+	clock.Advance(time.Second)
+	if r := <-ch; r.err == nil {
+		t.Errorf("expected a timeout, got %v", r.m)
+	}
+
+	go whois("bar")
+	runScript(t, conn, tr, []string{
+		"CLI WHOIS bar",
+		"SRV :irc.example.net 311 foo bar ~bar 127.0.0.1 * :bar",
+		"SRV :irc.example.net 318 foo bar :End of /WHOIS list",
+	})
+	if r := <-ch; r.err != nil || r.m.Command != "318" {
+		t.Errorf("unexpected reply %v (%v)", r.m, r.err)
+	}
+}
+
+// TestLag tests that the lag is measured from our PING to the PONG
+func TestLag(t *testing.T) {
+	clock := newFakeClock()
+	c, conn, tr := newTestClient(WithClock(clock))
+	defer conn.Server.Close()
+
+	go c.Ping("lag")
+	runScript(t, conn, tr, []string{"CLI PING :lag"})
+	clock.Advance(150 * time.Millisecond)
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net PONG irc.example.net :other",
+		"SRV :irc.example.net PONG irc.example.net :lag",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if lag := c.Lag(); lag != 150*time.Millisecond {
+		t.Errorf("got a lag of %v, expected 150ms", lag)
+	}
+}
+
+// TestSilence tests that the SILENCE limit is respected and that the list
+// is collected from the 271 and 272 replies
+func TestSilence(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	if err := c.Silence("bar!*@*"); err == nil {
+		t.Errorf("expected an error when SILENCE isn't supported")
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 005 foo SILENCE=2 :are supported by this server",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	go c.Silence("bar!*@*", "baz!*@*")
+	runScript(t, conn, tr, []string{
+		"CLI SILENCE +bar!*@*",
+		"CLI SILENCE +baz!*@*",
+		"SRV :foo!~foo@127.0.0.1 SILENCE +bar!*@*",
+		"SRV :foo!~foo@127.0.0.1 SILENCE +baz!*@*",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if err := c.Silence("qux!*@*"); err == nil {
+		t.Errorf("expected an error when the list is full")
+	}
+
+	type result struct {
+		masks []string
+		err   error
+	}
+	ch := make(chan result)
+	go func() {
+		masks, err := c.SilenceList()
+		ch <- result{masks, err}
+	}()
+	runScript(t, conn, tr, []string{
+		"CLI SILENCE",
+		"SRV :irc.example.net 271 foo foo bar!*@*",
+		"SRV :irc.example.net 271 foo foo baz!*@*",
+		"SRV :irc.example.net 272 foo :End of Silence List",
+	})
+
+	r := <-ch
+	if r.err != nil || !reflect.DeepEqual(r.masks, []string{"bar!*@*", "baz!*@*"}) {
+		t.Errorf("unexpected list %v (%v)", r.masks, r.err)
+	}
+}
+
+// TestNoTruncate makes sure that long lines are sent as they are when the
+// truncation is disabled
+func TestNoTruncate(t *testing.T) {
+	c, conn, tr := newTestClient(WithNoTruncate())
+	defer conn.Server.Close()
+
+	line := "PRIVMSG #foo :" + strings.Repeat("a", 600)
+	go c.SendRaw(line)
+	runScript(t, conn, tr, []string{
+		"CLI " + line,
+	})
+}
+
+// TestAutoAway makes sure that we are marked as away when idle and as back
+// when something is sent
+func TestAutoAway(t *testing.T) {
+	clock := newFakeClock()
+	c, conn, tr := newTestClient(WithClock(clock), WithAutoAway(time.Minute, "idle"))
+	defer conn.Server.Close()
+
+	// The timer starts once we are registered
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 001 foo :Welcome",
+	})
+	waitForWaiters(t, clock)
+	clock.Advance(time.Minute)
+	runScript(t, conn, tr, []string{
+		"CLI AWAY :idle",
+	})
+	go c.Privmsg("#foo", "hello")
+	runScript(t, conn, tr, []string{
+		"CLI AWAY",
+		"CLI PRIVMSG #foo :hello",
+	})
+
+	// The message restarted the timer
+	clock.Advance(59 * time.Second)
+	runScript(t, conn, tr, []string{
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+	clock.Advance(time.Second)
+	runScript(t, conn, tr, []string{
+		"CLI AWAY :idle",
+	})
+}
+
+// TestAutoAwayReclaim tests that the lines that the client sends on its own,
+// such as the nick reclaim on each PING, don't mark us as back
+func TestAutoAwayReclaim(t *testing.T) {
+	clock := newFakeClock()
+	c, conn, tr := newTestClient(WithClock(clock), WithAutoAway(time.Minute, "idle"))
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 433 * foo :Nickname already in use",
+		"CLI NICK foo_",
+		"SRV :irc.example.net 001 foo_ :Welcome",
+	})
+	waitForWaiters(t, clock)
+	clock.Advance(time.Minute)
+	runScript(t, conn, tr, []string{
+		"CLI AWAY :idle",
+		"SRV PING :irc.example.net",
+		"CLI PONG :irc.example.net",
+		"CLI WHOIS foo",
+	})
+
+	// We are still away until the user sends something
+	go c.Privmsg("#foo", "hello")
+	runScript(t, conn, tr, []string{
+		"CLI AWAY",
+		"CLI PRIVMSG #foo :hello",
+	})
+}
+
+// TestChannelMembers tests that the members of a channel and their prefixes
+// are tracked
+func TestChannelMembers(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 005 foo PREFIX=(qohv)~@%+ CHANMODES=b,k,l,imnt :are supported by this server",
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :irc.example.net 353 foo = #foo :~bar @foo %baz +qux quux!~quux@127.0.0.1",
+		"SRV :irc.example.net 366 foo #foo :End of /NAMES list.",
+		"SRV :bar!~bar@127.0.0.1 MODE #foo +lbv-h 10 *!*@example.com quux baz",
+		"SRV :qux!~qux@127.0.0.1 NICK corge",
+		"SRV :bar!~bar@127.0.0.1 KICK #foo baz :bye",
+		"SRV :grault!~grault@127.0.0.1 JOIN #foo",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	expected := map[string]string{
+		"bar":    "~",
+		"foo":    "@",
+		"corge":  "+",
+		"quux":   "+",
+		"grault": "",
+	}
+	if members := c.ChannelMembers("#FOO"); !reflect.DeepEqual(members, expected) {
+		t.Errorf("got members %v, expected %v", members, expected)
+	}
+
+	if !c.IsOp("#foo", "bar") || !c.IsOp("#foo", "foo") || c.IsOp("#foo", "quux") {
+		t.Errorf("unexpected operator status")
+	}
+	if !c.IsVoice("#foo", "quux") || !c.IsVoice("#foo", "bar") || c.IsVoice("#foo", "grault") {
+		t.Errorf("unexpected voice status")
+	}
+}
+
+// TestDefaultCaps makes sure that the default capabilities are negotiated
+// without any options
+func TestDefaultCaps(t *testing.T) {
+	conn := newMockComm()
+	defer conn.Server.Close()
+
+	c := NewClient(WithConn(conn.Client), WithNick("foo"))
+	go c.Connect()
+
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	runScript(t, conn, tr, []string{
+		"CLI CAP LS 302",
+		"CLI USER foo * * :foo",
+		"CLI NICK foo",
+		"SRV :irc.example.net CAP * LS :multi-prefix sasl userhost-in-names",
+		"CLI CAP REQ :multi-prefix userhost-in-names",
+		"SRV :irc.example.net CAP * ACK :multi-prefix userhost-in-names",
+		"CLI CAP END",
+	})
+
+	if !c.HasCap("multi-prefix") || !c.HasCap("userhost-in-names") {
+		t.Errorf("unexpected capabilities %v", c.Capabilities())
+	}
+}
+
+// TestMultiPrefix tests that all prefixes of a member are tracked
+func TestMultiPrefix(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :irc.example.net 353 foo = #foo :+@bar @foo",
+		"SRV :irc.example.net 366 foo #foo :End of /NAMES list.",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if p := c.MemberPrefixes("#foo", "bar"); p != "@+" {
+		t.Errorf("got prefixes %q, expected @+", p)
+	}
+	if !c.IsOp("#foo", "bar") || !c.IsVoice("#foo", "bar") {
+		t.Errorf("expected bar to be an operator with voice")
+	}
+
+	// bar keeps the voice when the operator status is removed
+	runScript(t, conn, tr, []string{
+		"SRV :foo!~foo@127.0.0.1 MODE #foo -o bar",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if c.IsOp("#foo", "bar") || !c.IsVoice("#foo", "bar") {
+		t.Errorf("expected bar to only have voice")
+	}
+	if p := c.ChannelMembers("#foo")["bar"]; p != "+" {
+		t.Errorf("got prefix %q, expected +", p)
+	}
+}
+
+// TestUserhostInNames tests that the user and host of the members are taken
+// from the NAMES reply
+func TestUserhostInNames(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net CAP * LS :userhost-in-names",
+		"CLI CAP REQ :userhost-in-names",
+		"SRV :irc.example.net CAP foo ACK :userhost-in-names",
+		"CLI CAP END",
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :irc.example.net 353 foo = #foo :@foo!~foo@127.0.0.1 +bar!~bar@bar.example.com baz",
+		"SRV :irc.example.net 366 foo #foo :End of /NAMES list.",
+		"SRV :qux!qux@192.0.2.1 JOIN #foo",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	expected := map[string]string{"foo": "@", "bar": "+", "baz": "", "qux": ""}
+	if members := c.ChannelMembers("#foo"); !reflect.DeepEqual(members, expected) {
+		t.Errorf("got members %v, expected %v", members, expected)
+	}
+
+	for nick, want := range map[string]string{"bar": "~bar@bar.example.com", "QUX": "qux@192.0.2.1", "baz": ""} {
+		user, host, ok := c.UserHost(nick)
+		if got := user + "@" + host; ok != (want != "") || ok && got != want {
+			t.Errorf("UserHost(%q) = %q, %v, expected %q", nick, got, ok, want)
+		}
+	}
+}
+
+// TestNetsplit tests that the QUITs and JOINs of a netsplit are dispatched as
+// single NETSPLIT and NETJOIN messages
+func TestNetsplit(t *testing.T) {
+	c, conn, tr := newTestClient(WithNetsplitDetection(50 * time.Millisecond))
+	defer conn.Server.Close()
+
+	events := make(chan string, 10)
+	for _, cmd := range []string{"QUIT", "JOIN", "NETSPLIT", "NETJOIN"} {
+		c.Handle(cmd, func(m *Message) {
+			events <- m.Command + " " + m.Name + " " + m.Params
+		})
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :bar!~bar@127.0.0.1 QUIT :hub.example.net leaf.example.net",
+		"SRV :baz!~baz@127.0.0.1 QUIT :hub.example.net leaf.example.net",
+		"SRV :qux!~qux@127.0.0.1 QUIT :gone to lunch",
+	})
+
+	expected := []string{
+		"QUIT qux :gone to lunch",
+		"NETSPLIT  hub.example.net leaf.example.net :bar baz",
+	}
+	for _, e := range expected {
+		select {
+		case got := <-events:
+			if got != e {
+				t.Errorf("got event %q, expected %q", got, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, expected %q", e)
+		}
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :bar!~bar@127.0.0.1 JOIN #foo",
+		"SRV :baz!~baz@127.0.0.1 JOIN #foo",
+		"SRV :bar!~bar@127.0.0.1 JOIN #bar",
+		"SRV :quux!~quux@127.0.0.1 JOIN #foo",
+	})
+
+	expected = []string{
+		"JOIN quux #foo",
+		"NETJOIN  hub.example.net leaf.example.net :bar baz",
+	}
+	for _, e := range expected {
+		select {
+		case got := <-events:
+			if got != e {
+				t.Errorf("got event %q, expected %q", got, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, expected %q", e)
+		}
+	}
+}
+
+// TestSendQueue tests the overflow policies of the send queue
+func TestSendQueue(t *testing.T) {
+	c := NewClient()
+	if err := c.Privmsg("#foo", "bar"); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected without a send queue, got %v", err)
+	}
+
+	c = NewClient(WithSendQueue(2, false))
+	c.Privmsg("#foo", "1")
+	c.Privmsg("#foo", "2")
+	if err := c.Privmsg("#foo", "3"); err == nil {
+		t.Errorf("expected an error when the queue is full")
+	}
+
+	c = NewClient(WithSendQueue(2, true))
+	for _, s := range []string{"1", "2", "3"} {
+		if err := c.Privmsg("#foo", s); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if len(c.sendQueue) != 2 || c.sendQueue[0].line != "PRIVMSG #foo :2" || c.sendQueue[1].line != "PRIVMSG #foo :3" {
+		t.Errorf("unexpected queue %v", c.sendQueue)
+	}
+
+	// Only messages are queued
+	if err := c.SendRaw("PONG :irc.example.net"); err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected for a PONG, got %v", err)
+	}
+
+	// The queued lines are sent in order once we are connected
+	conn := newMockComm()
+	defer conn.Server.Close()
+	c.conn = conn.Client
+	go c.flushSendQueue()
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	runScript(t, conn, tr, []string{
+		"CLI PRIVMSG #foo :2",
+		"CLI PRIVMSG #foo :3",
+	})
+}
+
+// TestSendQueueQuit makes sure that the send queue is cleared by Quit and
+// Shutdown, and that QUIT isn't queued itself
+func TestSendQueueQuit(t *testing.T) {
+	c := NewClient(WithSendQueue(10, false))
+	c.Privmsg("#foo", "bar")
+	c.Quit("bye")
+	if len(c.sendQueue) != 0 {
+		t.Errorf("unexpected queue %v", c.sendQueue)
+	}
+
+	c = NewClient(WithSendQueue(10, false))
+	c.Privmsg("#foo", "bar")
+	c.Shutdown(context.Background(), "bye")
+	if len(c.sendQueue) != 0 {
+		t.Errorf("unexpected queue %v", c.sendQueue)
+	}
+}
+
+// TestTargetRate makes sure that each target is throttled on its own
+func TestTargetRate(t *testing.T) {
+	c := NewClient(WithTargetRate(2, time.Second))
+
+	if c.reserveTarget("#foo") != 0 || c.reserveTarget("#FOO") != 0 {
+		t.Errorf("a burst of two messages should be allowed")
+	}
+	if d := c.reserveTarget("#foo"); d < 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("expected the third message to wait for about 500ms, got %v", d)
+	}
+	if d := c.reserveTarget("#bar"); d != 0 {
+		t.Errorf("#bar should not be throttled by #foo, got %v", d)
+	}
+}
+
+// TestIsAway tests that the away status of other users is tracked
+func TestIsAway(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	runScript(t, conn, tr, []string{
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :irc.example.net 353 foo = #foo :foo bar baz",
+		"SRV :bar!~bar@127.0.0.1 AWAY :gone fishing",
+		"SRV :baz!~baz@127.0.0.1 AWAY :lunch",
+		"SRV :baz!~baz@127.0.0.1 AWAY",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	if away, msg := c.IsAway("BAR"); !away || msg != "gone fishing" {
+		t.Errorf("expected bar to be away, got %v %s", away, msg)
+	}
+	if away, _ := c.IsAway("baz"); away {
+		t.Errorf("expected baz to be back")
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :bar!~bar@127.0.0.1 PART #foo",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+	if away, _ := c.IsAway("bar"); away {
+		t.Errorf("expected bar to be forgotten after leaving")
+	}
+}
+
+// TestHandleNumeric tests that the numerics are padded to three digits and
+// that codes outside of 0-999 are refused
+func TestHandleNumeric(t *testing.T) {
+	c := NewClient()
+
+	ch := make(chan string, 1)
+	if err := c.HandleNumeric(1, func(m *Message) { ch <- m.Command }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, code := range []int{-1, 1000} {
+		if err := c.HandleNumeric(code, func(m *Message) {}); err == nil {
+			t.Errorf("%d: expected an error", code)
+		}
+	}
+
+	c.dispatch(&Message{Command: "001"})
+	select {
+	case cmd := <-ch:
+		if cmd != "001" {
+			t.Errorf("got %s, expected 001", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("001 was not handled")
+	}
+}
+
+// TestHandleUnhandled makes sure that only messages without a handler are
+// passed to HandleUnhandled
+func TestHandleUnhandled(t *testing.T) {
+	c := NewClient()
+
+	ch := make(chan *Message, 2)
+	c.Handle("*", func(m *Message) {})
+	c.HandleNumeric(372, func(m *Message) {})
+	c.HandleUnhandled(func(m *Message) { ch <- m })
+
+	c.dispatch(&Message{Command: "372"})
+	c.dispatch(&Message{Command: "375"})
+
+	select {
+	case m := <-ch:
+		if m.Command != "375" {
+			t.Errorf("expected 375 to be unhandled, got %s", m.Command)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the unhandled message was not reported")
+	}
+
+	select {
+	case m := <-ch:
+		t.Errorf("unexpected unhandled message %s", m.Command)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestSendBatch makes sure that the lines of a batch are written together
+func TestSendBatch(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	go c.SendBatch("MODE #foo +m", "TOPIC #foo :quiet please", "INVITE bar #foo")
+	runScript(t, conn, tr, []string{
+		"CLI MODE #foo +m",
+		"CLI TOPIC #foo :quiet please",
+		"CLI INVITE bar #foo",
+	})
+}
+
+// TestReceivedAt tests that messages are timestamped when they are received
+// and that the server-time tag takes precedence
+func TestReceivedAt(t *testing.T) {
+	c, conn, _ := newTestClient()
+	defer conn.Server.Close()
+
+	ch := make(chan *Message, 2)
+	c.Handle("PRIVMSG", func(m *Message) { ch <- m })
+
+	before := time.Now()
+	fmt.Fprint(conn.Server, ":bar!~bar@127.0.0.1 PRIVMSG #foo :now"+eol)
+	fmt.Fprint(conn.Server, "@time=2026-10-17T12:00:00.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :then"+eol)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-ch:
+			switch m.Text() {
+			case "now":
+				if m.ReceivedAt.Before(before) || time.Since(m.ReceivedAt) > time.Second {
+					t.Errorf("unexpected receive time %v", m.ReceivedAt)
+				}
+			case "then":
+				if expected := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC); !m.ReceivedAt.Equal(expected) {
+					t.Errorf("got %v, expected %v", m.ReceivedAt, expected)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("message was not received")
+		}
+	}
+}
+
+// TestRegistrationState makes sure that each step of the registration is
+// reported once
+func TestRegistrationState(t *testing.T) {
+	conn := newMockComm()
+	defer conn.Server.Close()
+	c := NewClient(WithConn(conn.Client), WithNick("foo"), WithSASL("foo", "bar"))
+
+	var mu sync.Mutex
+	states := make(map[RegistrationState]int)
+	done := make(chan struct{})
+	c.OnRegistrationState(func(s RegistrationState) {
+		mu.Lock()
+		states[s]++
+		mu.Unlock()
+		if s == RegistrationComplete {
+			close(done)
+		}
+	})
+
+	go c.Connect()
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	runScript(t, conn, tr, []string{
+		"CLI CAP LS 302",
+		"CLI USER foo * * :foo",
+		"CLI NICK foo",
+		"SRV :irc.example.net CAP * LS :sasl",
+		"CLI CAP REQ :sasl",
+		"SRV :irc.example.net CAP foo ACK :sasl",
+		"CLI AUTHENTICATE PLAIN",
+		"SRV AUTHENTICATE +",
+		"CLI AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("foo\x00foo\x00bar")),
+		"SRV :irc.example.net 903 foo :SASL authentication successful",
+		"CLI CAP END",
+		"SRV :irc.example.net 001 foo :Welcome",
+		"SRV :irc.example.net 001 foo :Welcome",
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("registration was not reported as complete")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range []RegistrationState{
+		RegistrationCapStarted,
+		RegistrationSASLStarted,
+		RegistrationSASLSucceeded,
+		RegistrationCapFinished,
+		RegistrationNickAccepted,
+		RegistrationComplete,
+	} {
+		if states[s] != 1 {
+			t.Errorf("%s was reported %d times, expected once", s, states[s])
+		}
+	}
+	if states[RegistrationSASLFailed] != 0 {
+		t.Errorf("SASL failure should not be reported")
+	}
+}
+
+// TestJoinKeys tests that keys are matched to the channels by position
+func TestJoinKeys(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	go c.JoinKeys(map[string]string{"#d": "", "#a": "", "#c": "key_c", "#b": "key_b"})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.JoinKeys(map[string]string{"#a": "", "#b": ""})
+	}()
+	runScript(t, conn, tr, []string{
+		"CLI JOIN #b,#c,#a,#d key_b,key_c",
+		"CLI JOIN #a,#b",
+	})
+}
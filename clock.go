@@ -0,0 +1,46 @@
+package irc
+
+import (
+	"time"
+)
+
+// Clock is the source of time of the client, it can be replaced with
+// WithClock to control the time in tests
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current
+	// time on the returned channel
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep pauses the current goroutine for the duration
+	Sleep(d time.Duration)
+
+	// AfterFunc waits for the duration to elapse and then calls f in its
+	// own goroutine, the returned timer can be used to stop or reset it
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer that was created with the AfterFunc method of a Clock,
+// *time.Timer implements it
+type Timer interface {
+	// Stop prevents the timer from firing, it returns false if the timer
+	// has already fired or been stopped
+	Stop() bool
+
+	// Reset changes the timer to fire after the duration, it returns
+	// false if the timer had already fired or been stopped
+	Reset(d time.Duration) bool
+}
+
+// realClock is the default clock that uses the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
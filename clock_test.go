@@ -0,0 +1,244 @@
+package irc
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when it is told to, Sleep moves it
+// forward by the duration right away
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	timers  []*fakeTimer
+}
+
+// fakeWaiter is a channel that is waiting for the fake clock to reach a time
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// fakeTimer is a function that is called once the fake clock reaches a time
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	fn    func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.removeTimer(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.clock.removeTimer(t)
+	t.at = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	return active
+}
+
+// removeTimer removes the timer and reports whether it was pending, the
+// caller must hold mu
+func (f *fakeClock) removeTimer(t *fakeTimer) bool {
+	for i, p := range f.timers {
+		if p == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeWaiter{f.now.Add(d), ch})
+	return ch
+}
+
+func (f *fakeClock) Sleep(d time.Duration) {
+	f.Advance(d)
+}
+
+func (f *fakeClock) AfterFunc(d time.Duration, fn func()) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{clock: f, at: f.now.Add(d), fn: fn}
+	f.timers = append(f.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and fires the waiters and timers whose
+// time has come, the timer functions are called in their own goroutines
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = waiters
+
+	timers := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			timers = append(timers, t)
+			continue
+		}
+		go t.fn()
+	}
+	f.timers = timers
+}
+
+// Waiters returns the number of pending waiters
+func (f *fakeClock) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// TestClockTargetRate tests the rate limit with a fake clock
+func TestClockTargetRate(t *testing.T) {
+	clock := newFakeClock()
+	c := NewClient(WithClock(clock), WithTargetRate(2, time.Second))
+
+	c.reserveTarget("#foo")
+	c.reserveTarget("#foo")
+	if d := c.reserveTarget("#foo"); d.Round(time.Millisecond) != 500*time.Millisecond {
+		t.Errorf("expected the third message to wait for 500ms, got %v", d)
+	}
+
+	// The bucket is full again after a second
+	clock.Advance(1500 * time.Millisecond)
+	if d := c.reserveTarget("#foo"); d != 0 {
+		t.Errorf("expected the bucket to be refilled, got %v", d)
+	}
+}
+
+// TestClockReconnect tests that the reconnect waits are driven by the clock
+func TestClockReconnect(t *testing.T) {
+	clock := newFakeClock()
+	conns := make(chan *mockComm, 2)
+	c := NewClient(WithClock(clock), WithNick("foo"), WithConnFactory(func() (net.Conn, error) {
+		conn := newMockComm()
+		conns <- conn
+		return conn.Client, nil
+	}))
+	defer c.Quit("bye")
+
+	go c.Connect()
+
+	conn := <-conns
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	tr.ReadLine()
+	tr.ReadLine()
+	tr.ReadLine()
+	conn.Server.Close()
+
+	// Wait for the client to start waiting for the first attempt
+	waitForWaiters(t, clock)
+
+	select {
+	case <-conns:
+		t.Fatalf("the client reconnected before the clock moved")
+	default:
+	}
+
+	clock.Advance(5 * time.Second)
+	select {
+	case conn = <-conns:
+		defer conn.Server.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("the client didn't reconnect when the clock moved")
+	}
+}
+
+// waitForWaiters waits until the client is waiting for the fake clock
+func waitForWaiters(t *testing.T, clock *fakeClock) {
+	for i := 0; clock.Waiters() == 0; i++ {
+		if i == 100 {
+			t.Fatalf("the client isn't waiting for the clock")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRegistrationTimeout tests that the client reconnects when the server
+// doesn't complete the registration in time
+func TestRegistrationTimeout(t *testing.T) {
+	clock := newFakeClock()
+	conns := make(chan *mockComm, 2)
+	c := NewClient(WithClock(clock), WithNick("foo"), WithRegistrationTimeout(time.Minute),
+		WithConnFactory(func() (net.Conn, error) {
+			conn := newMockComm()
+			conns <- conn
+			return conn.Client, nil
+		}))
+	defer c.Quit("bye")
+
+	reasons := make(chan string, 1)
+	c.OnDisconnect(func(reason string) { reasons <- reason })
+
+	go c.Connect()
+
+	// The server never sends 001
+	conn := <-conns
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	tr.ReadLine()
+	tr.ReadLine()
+	tr.ReadLine()
+
+	waitForWaiters(t, clock)
+	clock.Advance(time.Minute)
+	if _, err := tr.ReadLine(); err == nil {
+		t.Fatalf("expected the connection to be closed")
+	}
+
+	select {
+	case r := <-reasons:
+		if r != errRegistrationTimeout.Error() {
+			t.Errorf("unexpected reason %q", r)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the disconnect wasn't reported")
+	}
+
+	// The client reconnects after the usual wait
+	waitForWaiters(t, clock)
+	clock.Advance(5 * time.Second)
+	select {
+	case conn = <-conns:
+		defer conn.Server.Close()
+	case <-time.After(time.Second):
+		t.Fatalf("the client didn't reconnect")
+	}
+}
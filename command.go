@@ -0,0 +1,82 @@
+package irc
+
+import (
+	"strings"
+)
+
+// defaultCommandPrefix is the prefix of bot commands unless another one is
+// set with WithCommandPrefix
+const defaultCommandPrefix = "!"
+
+// CommandContext is passed to the function of a bot command
+type CommandContext struct {
+	// Client is the client that received the command
+	Client *Client
+
+	// From is the nick that sent the command
+	From string
+
+	// Target is where replies go, the channel that the command was sent
+	// to or the nick that sent it if it was sent to us in private
+	Target string
+
+	// Command is the name of the command without the prefix
+	Command string
+
+	// Args contains the words that followed the command
+	Args []string
+
+	// Message is the PRIVMSG that contained the command
+	Message *Message
+}
+
+// Reply sends the text to the target of the command
+func (ctx *CommandContext) Reply(text string) error {
+	return ctx.Client.Privmsg(ctx.Target, text)
+}
+
+// Command registers a bot command, the function is called for each PRIVMSG
+// that starts with the command prefix followed by the name. The name is
+// case insensitive and registering a name again replaces the function.
+func (c *Client) Command(name string, fn func(ctx *CommandContext)) {
+	c.commandsMu.Lock()
+	c.commands[strings.ToLower(name)] = fn
+	c.commandsMu.Unlock()
+}
+
+// handleCommand dispatches a PRIVMSG to the bot command that it contains
+func (c *Client) handleCommand(m *Message) {
+	// PRIVMSG <target> :<prefix><command> [<arg> ...]
+	text := m.Text()
+	if len(m.ParamsArray) == 0 || !strings.HasPrefix(text, c.commandPrefix) {
+		return
+	}
+	args := strings.Fields(text[len(c.commandPrefix):])
+	if len(args) == 0 {
+		return
+	}
+
+	c.commandsMu.Lock()
+	fn, ok := c.commands[strings.ToLower(args[0])]
+	c.commandsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	// Replies to commands that were sent to us go back to the sender
+	target := m.ParamsArray[0]
+	c.infoMu.Lock()
+	if c.casefold(target) == c.casefold(c.currentNick) {
+		target = m.Name
+	}
+	c.infoMu.Unlock()
+
+	fn(&CommandContext{
+		Client:  c,
+		From:    m.Name,
+		Target:  target,
+		Command: args[0],
+		Args:    args[1:],
+		Message: m,
+	})
+}
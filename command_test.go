@@ -0,0 +1,28 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCommand tests that bot commands are dispatched and that replies go to
+// the channel or to the sender of a private command
+func TestCommand(t *testing.T) {
+	c, conn, tr := newTestClient(WithCommandPrefix("."))
+	defer conn.Server.Close()
+
+	c.Command("echo", func(ctx *CommandContext) {
+		ctx.Reply(ctx.From + " said " + strings.Join(ctx.Args, " "))
+	})
+
+	runScript(t, conn, tr, []string{
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :!echo wrong prefix",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :.unknown command",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :.ECHO hello  there",
+		"CLI PRIVMSG #foo :bar said hello there",
+		"SRV :baz!~baz@127.0.0.1 PRIVMSG foo :.echo psst",
+		"CLI PRIVMSG baz :baz said psst",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+}
@@ -6,17 +6,54 @@ import (
 	"io"
 	"net"
 	"net/textproto"
+	"strconv"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
 )
 
-// Connect connects to the IRC server
+// Connect connects to the IRC server and runs the main loop until we quit or
+// give up on reconnecting. If Quit has been called before Connect, Connect
+// returns immediately. A Quit after an earlier Connect has returned doesn't
+// affect the next Connect.
 func (c *Client) Connect() error {
+	// The quit belongs to a main loop that has ended already
+	if atomic.CompareAndSwapInt32(&c.ended, 1, 0) {
+		select {
+		case <-c.quit:
+		default:
+		}
+	}
+	defer atomic.StoreInt32(&c.ended, 1)
+
+	return c.connect()
+}
+
+// connect connects to the server and runs the main loop, reconnect calls it
+// for each attempt
+func (c *Client) connect() error {
 	var err error
 
-	// Make sure we have either a connection or an address set
-	if c.conn == nil && c.addr == "" {
-		return fmt.Errorf("no conn or addr found, use WithConn or WithAddr")
+	// Quit might have been called before we got here, if so there's
+	// nothing more to do.
+	select {
+	case <-c.quit:
+		c.writeMu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+		c.writeMu.Unlock()
+		c.signalStopped()
+		return nil
+	default:
+	}
+
+	// Make sure we have either a connection or a way to create one
+	if c.conn == nil && c.addr == "" && c.connFactory == nil {
+		return fmt.Errorf("no conn or addr found, use WithConn, WithConnFactory or WithAddr")
 	}
 
 	// Check if we have set a nick
@@ -24,9 +61,8 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("no nick set, use WithNick to set the nick")
 	}
 
-	// Set current nick to nick
-	// This is used so we can get our wanted nick back if it is taken during the connect
-	c.currentNick = c.nick
+	// Reset the state from any previous connection
+	c.resetState()
 
 	// Set user to nick if it isn't set
 	if c.user == "" {
@@ -38,44 +74,152 @@ func (c *Client) Connect() error {
 		c.realName = c.nick
 	}
 
-	// Dial the server, if we don't have a connection already
-	if c.conn == nil {
-		if c.conn, err = net.Dial("tcp", c.addr); err != nil {
+	// Make sure that the PROXY addresses are valid before we connect
+	var proxy string
+	if c.proxySrc != "" || c.proxyDst != "" {
+		if proxy, err = proxyHeader(c.proxySrc, c.proxyDst); err != nil {
 			return err
 		}
 	}
 
-	// Send the USER command
-	if err = c.Sendf("USER %s * * :%s", c.user, c.realName); err != nil {
+	// The server might ask who we are as soon as we connect
+	c.startIdent()
+
+	// Dial the server, if we don't have a connection already. If we have
+	// one we'll remember how to connect again when it is lost.
+	if c.conn != nil {
+		if err = c.rememberConn(c.conn); err != nil {
+			return err
+		}
+	} else {
+		var conn net.Conn
+		if c.connFactory != nil {
+			conn, err = c.connFactory()
+		} else {
+			conn, err = c.dial()
+		}
+		if err != nil {
+			return err
+		}
+
+		c.writeMu.Lock()
+		c.conn = conn
+		c.writeMu.Unlock()
+	}
+
+	// Announce the addresses if we are behind a proxy that expects the
+	// PROXY protocol, this must be the first thing that is sent
+	if proxy != "" {
+		if err = c.send(proxy); err != nil {
+			return err
+		}
+	}
+
+	// Start the capability negotiation if we want any capabilities, the
+	// server holds the registration until the negotiation has ended. The
+	// default capabilities are always wanted, servers that don't know CAP
+	// just ignore it.
+	if len(c.sasl) > 0 && indexOf(c.capWant, "sasl") < 0 {
+		c.capWant = append(c.capWant, "sasl")
+	}
+	if len(defaultCaps) > 0 || len(c.capWant) > 0 {
+		if err = c.send("CAP LS 302"); err != nil {
+			return err
+		}
+		c.setRegistrationState(RegistrationCapStarted)
+	}
+
+	// Send the USER command, the mode is * unless a bitmask is set
+	mode := "*"
+	if c.userRegMode > 0 {
+		mode = strconv.Itoa(c.userRegMode)
+	}
+	if err = c.send(fmt.Sprintf("USER %s %s * :%s", c.user, mode, c.realName)); err != nil {
 		return err
 	}
 
 	// Send the NICK command
-	if err = c.Nick(c.currentNick); err != nil {
+	if err = c.send("NICK " + c.currentNick); err != nil {
 		return err
 	}
 
+	// Give up on the connection if the server doesn't complete the
+	// registration in time
+	c.startRegistrationTimeout()
+
 	// Start main loop and return the value
 	return c.loop()
 }
 
-// reconnect tries to reconnect to the server
-func (c *Client) reconnect() error {
+// Reconnect closes the connection to the server and connects again, the
+// channels are rejoined once we are registered. It is safe to call while
+// connected, the actual reconnect is performed by the goroutine that called
+// Connect so there is never more than one connection.
+func (c *Client) Reconnect() error {
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	// Tell the main loop that the read error that follows is expected
+	select {
+	case c.reconnectReq <- true:
+	default:
+	}
+
+	return conn.Close()
+}
+
+// reconnect tries to reconnect to the server, the first attempt is made
+// immediately if now is true
+func (c *Client) reconnect(now bool) error {
 	// Close the connection
+	c.writeMu.Lock()
 	c.conn.Close()
 	c.conn = nil
+	c.discardWrites()
+	c.writeMu.Unlock()
+
+	// A connection that was given with WithConn can't be re-established
+	// unless we know how to create a new one
+	if c.addr == "" && c.connFactory == nil {
+		return fmt.Errorf("connection lost, use WithAddr or WithConnFactory to be able to reconnect")
+	}
+
+	// A requested reconnect is tried right away, we fall back to the
+	// regular attempts if it fails
+	if now {
+		err := c.connect()
+		if err == nil {
+			return nil
+		}
+		c.log(err.Error())
+	}
 
 	// Reconnect time
 	rt := 5 * time.Second
 
 	// Try to reconnect 10 times before giving up
 	for i := 0; i < 10; i++ {
-		// Retry after rt seconds has passed
+		// Retry after rt seconds has passed, unless we quit while we
+		// are waiting
 		c.log("connection closed, trying to reconnect in %d seconds", rt/time.Second)
-		time.Sleep(rt)
+		select {
+		case <-c.quit:
+			c.resetState()
+			c.signalStopped()
+			return nil
+		case <-c.done:
+			c.signalStopped()
+			return nil
+		case <-c.clock.After(rt):
+		}
 
 		// Connect to the server
-		err := c.Connect()
+		err := c.connect()
 
 		// If no error we assume that the connect was successful
 		if err == nil {
@@ -92,6 +236,57 @@ func (c *Client) reconnect() error {
 	return fmt.Errorf("unable to reconnect, giving up")
 }
 
+// disconnected reports that the connection was lost to the functions that
+// are registered with OnDisconnect
+func (c *Client) disconnected(err error) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	reason := c.errorReason
+	if reason == "" {
+		reason = err.Error()
+	}
+	for _, fn := range c.disconnectFns {
+		go fn(reason)
+	}
+}
+
+// decode converts a line that was received from the server to UTF-8, if an
+// encoding has been set with WithEncoding it is used, otherwise fixEncoding
+// is used unless WithReplaceInvalidUTF8 is set.
+func (c *Client) decode(buf []byte) string {
+	// The line is kept as is if invalid UTF-8 should be replaced after
+	// the line has been parsed
+	if c.encoding == nil && c.replaceInvalidUTF8 {
+		return string(buf)
+	}
+
+	if c.encoding == nil {
+		return fixEncoding(buf)
+	}
+
+	b, err := c.encoding.NewDecoder().Bytes(buf)
+	if err != nil {
+		return fixEncoding(buf)
+	}
+	return string(b)
+}
+
+// encode converts a line that is going to be sent to the server from UTF-8
+// to the encoding that has been set with WithEncoding, characters that can't
+// be represented in the encoding are replaced.
+func (c *Client) encode(s string) string {
+	if c.encoding == nil {
+		return s
+	}
+
+	r, err := encoding.ReplaceUnsupported(c.encoding.NewEncoder()).String(s)
+	if err != nil {
+		return s
+	}
+	return r
+}
+
 // fixEncoding checks whether or not the given buf is utf-8 encoded, if it
 // isn't we'll assume it is encoded using ISO8859-1, in which case we'll
 // encode it to use UTF-8 instead.
@@ -109,6 +304,9 @@ func fixEncoding(buf []byte) string {
 
 // loop is responsible for reading and parsing messages from the server
 func (c *Client) loop() error {
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+
 	// Initialize connection reader
 	rd := bufio.NewReader(c.conn)
 	tr := textproto.NewReader(rd)
@@ -123,10 +321,36 @@ func (c *Client) loop() error {
 		default:
 			// Read one line from the connection
 			b, err := tr.ReadLineBytes()
-			l := fixEncoding(b)
+			receivedAt := c.clock.Now()
+			l := c.decode(b)
 
 			// Print the line if we have debugging enabled
-			c.log(l)
+			if l != "" {
+				c.log("<< %s", l)
+			}
+
+			// The connection is expected to end if we have quit,
+			// and Reconnect closes it to reconnect right away
+			if err != nil {
+				select {
+				case <-c.quit:
+					goto quit
+				case <-c.reconnectReq:
+					return c.reconnect(true)
+				case <-c.regTimeout:
+					c.disconnected(errRegistrationTimeout)
+					goto reconnect
+				default:
+				}
+
+				// We have sent a QUIT and the server closed the
+				// connection before the quit was signalled
+				if atomic.LoadInt32(&c.quitting) == 1 {
+					goto quit
+				}
+
+				c.disconnected(err)
+			}
 
 			// EOF received, try to reconnect
 			if err == io.EOF {
@@ -146,32 +370,44 @@ func (c *Client) loop() error {
 				continue
 			}
 
-			// If we are joinning a channel we'll store the
-			// current user and current host in the client, this
-			// will be used to calculate the correct number of
-			// bytes that we are allowed to send to the server.
-			if m.Command == "JOIN" && m.Name == c.currentNick {
-				c.infoMu.Lock()
-				c.currentUser = m.User
-				c.currentHost = m.Host
-				c.infoMu.Unlock()
+			// Remember when the message was received, unless the
+			// server tells us when it was sent
+			m.ReceivedAt = receivedAt
+			if t, ok := m.Time(); ok {
+				m.ReceivedAt = t
 			}
 
-			// Send the message to the event hub
-			// We use the command as event name
-			c.hub.Send(m.Command, m)
+			// Replace invalid UTF-8 in the parsed message if we
+			// are asked to do so
+			if c.replaceInvalidUTF8 {
+				m.replaceInvalidUTF8()
+			}
+
+			// Update the client state before the message is
+			// dispatched so that the event handlers can rely on it
+			c.updateState(m)
 
-			// Let's also send the message to the wildcard event
-			c.hub.Send("*", m)
+			// Pass the message to anyone that waits for a reply
+			c.notifyWaiters(m)
+
+			// Send the message through the middleware chain to the
+			// event hub
+			c.dispatch(m)
 		}
 	}
 
 reconnect:
 	// Try to reconnect to the server
-	return c.reconnect()
+	return c.reconnect(false)
 
 quit:
-	// Quit closes the connection and returns from the function
+	// Quit closes the connection and returns from the function, the next
+	// Connect needs a new connection
+	c.writeMu.Lock()
 	c.conn.Close()
+	c.conn = nil
+	c.writeMu.Unlock()
+	c.resetState()
+	c.signalStopped()
 	return nil
 }
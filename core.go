@@ -1,7 +1,11 @@
 package irc
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/osm/ww"
@@ -9,54 +13,175 @@ import (
 
 // log logs the message with the logger
 func (c *Client) log(format string, args ...interface{}) {
-	if c.debug && format != "" {
+	if c.Debug() && format != "" {
 		c.logger.Printf(format, args...)
 	}
 }
 
+// SetDebug enables or disables logging of the communication with the server,
+// it can be called at any time
+func (c *Client) SetDebug(debug bool) {
+	c.debugMu.Lock()
+	c.debug = debug
+	c.debugMu.Unlock()
+}
+
+// Debug returns true if the communication with the server is logged
+func (c *Client) Debug() bool {
+	c.debugMu.Lock()
+	defer c.debugMu.Unlock()
+	return c.debug
+}
+
 // Sendf sends a message to the server and appends CR-LF at the end of the string
 func (c *Client) Sendf(format string, args ...interface{}) error {
-	// Make sure that conn isn't nil before we proceed.
-	if c.conn == nil {
+	return c.sendActivity(fmt.Sprintf(format, args...))
+}
+
+// SendRaw sends a line to the server as is and appends CR-LF at the end of
+// it, use this instead of Sendf when the line shouldn't be formatted
+func (c *Client) SendRaw(line string) error {
+	return c.sendActivity(line)
+}
+
+// sendActivity sends a line on behalf of the user, unlike the lines that the
+// client sends on its own with send it counts as activity for the auto away
+func (c *Client) sendActivity(s string) error {
+	c.touchAway(s)
+	return c.send(s)
+}
+
+// ErrNotConnected is returned when something is sent while the client isn't
+// connected to the server
+var ErrNotConnected = errors.New("not connected")
+
+// send writes the line to the server, any secrets that are given will be
+// redacted from the debug log. The line doesn't count as activity for the
+// auto away, see sendActivity.
+func (c *Client) send(s string, secrets ...string) error {
+	// Make sure that conn isn't nil before we proceed, the line is
+	// queued until we are connected again if a send queue is used.
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+	if conn == nil {
+		return c.enqueue(s, secrets)
+	}
+
+	// Write it to server and return
+	return c.write(c.prepare(s, secrets...))
+}
+
+// SendBatch sends the lines to the server with a single write, so they
+// aren't interleaved with lines that are sent by other goroutines. CR-LF is
+// appended to each line and long lines are truncated as in SendRaw.
+func (c *Client) SendBatch(lines ...string) error {
+	if len(lines) == 0 {
 		return nil
 	}
 
-	// Format the string
-	s := fmt.Sprintf(format+eol, args...)
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+	if conn == nil {
+		for _, l := range lines {
+			if err := c.enqueue(l, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	c.touchAway(lines[0])
+
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(c.prepare(l))
+	}
+	return c.write(b.String())
+}
+
+// prepare applies the outgoing transforms to the line, converts it to the
+// encoding of the server, truncates it if it is too long, unless
+// WithNoTruncate is used, and appends CR-LF.
+// The line is written to the debug log with the secrets redacted.
+func (c *Client) prepare(s string, secrets ...string) string {
+	// Let the outgoing transforms have their say first
+	s = c.transformOut(s)
 
-	// An IRC message has a limit of maximum 510 characters, so we'll just
-	// truncate the rest of the message if it's too big.
+	// Message tags doesn't count towards the size limit, so we'll keep
+	// them aside while the rest of the message is processed
+	var tags string
+	if strings.Index(s, tagPrefix) == 0 {
+		if i := strings.Index(s, " "); i >= 0 {
+			tags, s = s[:i+1], s[i+1:]
+		}
+	}
+
+	// Convert the line to the encoding of the server and append CR-LF
+	s = c.encode(s) + eol
+
+	// An IRC message has a limit of maximum 510 characters, or whatever
+	// maxLineLength says, so we'll just truncate the rest of the message
+	// if it's too big.
 	// We are calling the ww.Wrap function before the data gets here, but
 	// it is a possibility that a really long word (510 characters) gets
-	// to this point, and if it does we'll truncate the message.
-	if len(s) > 510 {
-		s = s[0:510] + eol
+	// to this point, and if it does we'll truncate the message, unless
+	// we have been told to leave the lines alone.
+	if n := c.maxLineLength(); !c.noTruncate && len(s) > n+len(eol) {
+		s = s[0:n] + eol
 	}
+	s = tags + s
 
 	// Log message if we have debugging enabled
-	c.log(s)
+	c.log(">> %s", strings.TrimSuffix(redact(s, secrets...), eol))
 
-	// Write it to server and return
-	_, err := c.conn.Write([]byte(s))
-	return err
+	return s
 }
 
-// Privmsg sends a message to a channel or nick
-func (c *Client) Privmsg(target, message string) error {
-	prefix := fmt.Sprintf(": %s!%s@%s", c.currentNick, c.currentUser, c.currentHost)
-	cmd := fmt.Sprintf("PRIVMSG %s :", target)
+// minLineLength is the smallest line length that WithMaxLineLength accepts
+const minLineLength = 128
 
-	for i, m := range ww.Wrap(message, 510-len(prefix)-len(cmd)) {
-		if err := c.Sendf("%s%s", cmd, m); err != nil {
-			return err
-		}
+// maxLineLength returns the maximum length of a line without CR-LF, the
+// length that is set with WithMaxLineLength takes precedence over the
+// LINELEN that the server advertises, 510 is used if neither is set.
+func (c *Client) maxLineLength() int {
+	if c.lineLength > 0 {
+		return c.lineLength
+	}
 
-		if i >= 1 {
-			time.Sleep(time.Millisecond * 500)
+	// The server line length is accessed atomically since lines are
+	// sent while infoMu is held
+	if n := int(atomic.LoadInt32(&c.serverLineLength)); n > 0 {
+		return n
+	}
+	return int(maxSize) - len(eol)
+}
+
+// updateLineLength stores the LINELEN that the server advertises, the
+// caller must hold infoMu
+func (c *Client) updateLineLength() {
+	var n int
+	if v, err := strconv.Atoi(c.isupport["LINELEN"]); err == nil && v-len(eol) >= minLineLength {
+		n = v - len(eol)
+	}
+	atomic.StoreInt32(&c.serverLineLength, int32(n))
+}
+
+// redact replaces all the secrets in s with asterisks
+func redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, "***", -1)
 		}
 	}
+	return s
+}
 
-	return nil
+// Privmsg sends a message to a channel or nick
+func (c *Client) Privmsg(target, message string) error {
+	c.touchAway("PRIVMSG")
+	return c.sendText("PRIVMSG", target, message)
 }
 
 // Privmsgf sends a privmsg and accepts a format string as message argument
@@ -66,25 +191,61 @@ func (c *Client) Privmsgf(target, format string, args ...interface{}) error {
 
 // Notice sends a notice
 func (c *Client) Notice(target, message string) error {
+	c.touchAway("NOTICE")
+	return c.sendText("NOTICE", target, message)
+}
+
+// Noticef sends a notice and accepts a format string as message argument
+func (c *Client) Noticef(target, format string, args ...interface{}) error {
+	return c.Notice(target, fmt.Sprintf(format, args...))
+}
+
+// sendText sends a PRIVMSG or NOTICE, the message is split into multiple
+// messages if it doesn't fit on one line. It doesn't count as activity for
+// the auto away, Privmsg and Notice take care of that.
+func (c *Client) sendText(command, target, message string) error {
 	prefix := fmt.Sprintf(": %s!%s@%s", c.currentNick, c.currentUser, c.currentHost)
-	cmd := fmt.Sprintf("NOTICE %s :", target)
+	cmd := fmt.Sprintf("%s %s :", command, target)
+
+	// Remember the target so that a failure to deliver can be reported
+	c.recordSend(target)
 
-	for i, m := range ww.Wrap(message, 510-len(prefix)-len(cmd)) {
-		if err := c.Sendf("%s%s", cmd, m); err != nil {
+	for i, m := range splitMessage(message, c.maxLineLength()-len(prefix)-len(cmd)) {
+		// Wait if we are sending too fast to the target
+		c.clock.Sleep(c.reserveTarget(target))
+
+		if err := c.send(cmd + m); err != nil {
 			return err
 		}
 
 		if i >= 1 {
-			time.Sleep(time.Millisecond * 500)
+			c.clock.Sleep(time.Millisecond * 500)
 		}
 	}
 
 	return nil
 }
 
-// Noticef sends a notice and accepts a format string as message argument
-func (c *Client) Noticef(target, format string, args ...interface{}) error {
-	return c.Notice(target, fmt.Sprintf(format, args...))
+// splitMessage splits the message into chunks that are at most width bytes
+// long. A CTCP message is split so that each chunk is a CTCP message with
+// the same command, e.g. a long ACTION becomes multiple ACTIONs.
+func splitMessage(message string, width int) []string {
+	if len(message) < 2 || !strings.HasPrefix(message, ctcpDelim) || !strings.HasSuffix(message, ctcpDelim) {
+		return ww.Wrap(message, width)
+	}
+
+	// \x01<command> <args>\x01
+	p := strings.SplitN(message[1:len(message)-1], " ", 2)
+	if len(p) < 2 {
+		return []string{message}
+	}
+
+	head := ctcpDelim + p[0] + " "
+	var chunks []string
+	for _, s := range ww.Wrap(p[1], width-len(head)-len(ctcpDelim)) {
+		chunks = append(chunks, head+s+ctcpDelim)
+	}
+	return chunks
 }
 
 // Mode sets mode on a channel for a nick
@@ -97,11 +258,86 @@ func (c *Client) Nick(nick string) error {
 	return c.Sendf("NICK %s", nick)
 }
 
+// nickFailures contains the numerics that the server replies with when a
+// nick change fails
+var nickFailures = map[string]bool{
+	"432": true, // ERR_ERRONEUSNICKNAME
+	"433": true, // ERR_NICKNAMEINUSE
+	"436": true, // ERR_NICKCOLLISION
+	"437": true, // ERR_UNAVAILRESOURCE
+}
+
+// ChangeNick changes our nick and waits until the server confirms the change,
+// an error with the reason is returned if the server refuses it or doesn't
+// reply in time. Unlike Nick the new nick also becomes the wanted nick once
+// the change has been confirmed, so it is the nick that is reclaimed from
+// now on. Before we are registered the
+// nick is sent as is and the usual fallback applies if it is taken.
+func (c *Client) ChangeNick(nick string) error {
+	c.infoMu.Lock()
+	registered := c.registered
+	old := c.casefold(c.currentNick)
+	if !registered {
+		c.nick = nick
+		c.currentNick = nick
+	}
+	c.infoMu.Unlock()
+
+	if !registered {
+		return c.Nick(nick)
+	}
+
+	m, err := c.SendAndWait("NICK "+nick, func(m *Message) bool {
+		c.infoMu.Lock()
+		defer c.infoMu.Unlock()
+
+		switch {
+		case m.Command == "NICK" && len(m.ParamsArray) > 0:
+			// :<old> NICK :<new>
+			return c.casefold(m.Name) == old &&
+				c.casefold(strings.TrimPrefix(m.ParamsArray[0], prefix)) == c.casefold(nick)
+		case nickFailures[m.Command] && len(m.ParamsArray) > 1:
+			// <me> <nick> :<reason>
+			return c.casefold(m.ParamsArray[1]) == c.casefold(nick)
+		}
+		return false
+	}, replyTimeout)
+	if err != nil {
+		return err
+	}
+
+	if m.Command != "NICK" {
+		return fmt.Errorf("unable to change nick to %s: %s", nick, m.Text())
+	}
+
+	c.infoMu.Lock()
+	c.nick = nick
+	c.infoMu.Unlock()
+	return nil
+}
+
 // GetNick returns the current nick
 func (c *Client) GetNick() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
 	return c.currentNick
 }
 
+// WantedNick returns the nick that was set with WithNick, this differs from
+// GetNick while we are using a fallback nick
+func (c *Client) WantedNick() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.nick
+}
+
+// Registered returns true when the server has accepted our registration
+func (c *Client) Registered() bool {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.registered
+}
+
 // ReclaimNick tries to reclaim the nick
 func (c *Client) ReclaimNick() {
 	// Acquire a lock to prevent race condition
@@ -109,22 +345,164 @@ func (c *Client) ReclaimNick() {
 
 	// Check if we actually don't have the wanted nick
 	if c.nick != c.currentNick {
-		// Perform a WHOIS request
-		// We check for event 401 in events.go and tries to reclaim the nick if it's free
-		c.Whois(c.nick)
+		if c.nickServPassword != "" {
+			// Ask NickServ to disconnect whoever is using our nick
+			// The QUIT handler in events.go changes the nick when it's free
+			c.Ghost(c.nick, c.nickServPassword)
+		} else {
+			// Perform a WHOIS request
+			// We check for event 401 in events.go and tries to reclaim the nick if it's free
+			c.send("WHOIS " + c.nick)
+		}
 	}
 
 	// Release the lock
 	c.infoMu.Unlock()
 }
 
+// minAutoReclaim is the shortest interval that is allowed for WithAutoReclaim
+const minAutoReclaim = 5 * time.Second
+
+// autoReclaimNick tries to reclaim the nick at the interval set with
+// WithAutoReclaim until we have it or until the connection is gone
+func (c *Client) autoReclaimNick() {
+	c.infoMu.Lock()
+	gen := c.connGen
+	c.infoMu.Unlock()
+
+	for {
+		select {
+		case <-c.clock.After(c.autoReclaim):
+		case <-c.done:
+			return
+		}
+
+		c.infoMu.Lock()
+		done := gen != c.connGen || c.nick == c.currentNick
+		c.infoMu.Unlock()
+
+		if done {
+			return
+		}
+
+		c.ReclaimNick()
+	}
+}
+
 // Whois sends a WHOIS request
 func (c *Client) Whois(nick string) error {
 	return c.Sendf("WHOIS %s", nick)
 }
 
-// Quit sends a QUIT message to the server and terminates the connection
+// Oper sends an OPER request, the password is never written to the debug
+// log. The server replies with 381 if we are now an operator and with 464
+// or 491 if the request failed, use Handle to listen for the replies.
+func (c *Client) Oper(name, password string) error {
+	return c.send(fmt.Sprintf("OPER %s %s", name, password), password)
+}
+
+// Kill disconnects the nick from the network, this requires that we are an
+// operator. The server replies with 481 if we don't have the privileges and
+// with 401 if the nick doesn't exist, use Handle to listen for the replies.
+func (c *Client) Kill(nick, reason string) error {
+	return c.Sendf("KILL %s :%s", nick, reason)
+}
+
+// WhowasEntry contains the information that the server returned about a
+// nick that no longer exists
+type WhowasEntry struct {
+	Nick      string
+	User      string
+	Host      string
+	RealName  string
+	Server    string
+	SignedOff string
+}
+
+// Whowas sends a WHOWAS request and returns the entries that the server
+// replied with, the most recent entry comes first. If count is larger than
+// zero it limits the number of entries that the server returns. An empty
+// result is returned if the server doesn't know anything about the nick.
+func (c *Client) Whowas(nick string, count int) ([]WhowasEntry, error) {
+	// Register a waiter for all the replies that concern the nick
+	w := c.wait(func(m *Message) bool {
+		switch m.Command {
+		case "312", "314", "369", "406":
+			return len(m.ParamsArray) > 1 && strings.EqualFold(m.ParamsArray[1], nick)
+		}
+		return false
+	})
+	defer c.stopWait(w)
+
+	// Send the request
+	var err error
+	if count > 0 {
+		err = c.Sendf("WHOWAS %s %d", nick, count)
+	} else {
+		err = c.Sendf("WHOWAS %s", nick)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the replies until we get the end of WHOWAS numeric
+	var entries []WhowasEntry
+	timeout := c.clock.After(replyTimeout)
+	for {
+		select {
+		case m := <-w.ch:
+			switch m.Command {
+			case "314":
+				// <me> <nick> <user> <host> * :<real name>
+				if len(m.ParamsArray) < 4 {
+					continue
+				}
+				entries = append(entries, WhowasEntry{
+					Nick:     m.ParamsArray[1],
+					User:     m.ParamsArray[2],
+					Host:     m.ParamsArray[3],
+					RealName: m.Text(),
+				})
+			case "312":
+				// <me> <nick> <server> :<signoff time>
+				// The server reply belongs to the latest 314
+				if len(m.ParamsArray) < 3 || len(entries) == 0 {
+					continue
+				}
+				entries[len(entries)-1].Server = m.ParamsArray[2]
+				entries[len(entries)-1].SignedOff = m.Text()
+			case "369":
+				return entries, nil
+			}
+
+			// 406 means that there was no such nick, the server
+			// still ends the reply with 369 so we'll just keep
+			// on waiting for it.
+
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for WHOWAS reply for %s", nick)
+		}
+	}
+}
+
+// Quit sends a QUIT message to the server and terminates the connection, it
+// is safe to call before Connect in which case Connect returns immediately.
 func (c *Client) Quit(message string) {
-	c.Sendf("QUIT :%s", message)
-	c.quit <- true
+	// Messages that are waiting for a reconnect will never be sent
+	c.clearSendQueue()
+
+	// The server closes the connection when it gets the QUIT, so the main
+	// loop must know that this is expected before the QUIT is sent. The
+	// quit itself is signalled once the QUIT has been written, otherwise
+	// the main loop might close the connection before it goes out.
+	atomic.StoreInt32(&c.quitting, 1)
+	c.send("QUIT :" + message)
+	c.Flush()
+	c.stopAutoAway()
+
+	// Don't block if a quit already is pending
+	select {
+	case c.quit <- true:
+	default:
+	}
 }
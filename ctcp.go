@@ -0,0 +1,189 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CTCP delimiter and quoting characters
+const (
+	ctcpDelim  = "\x01"
+	lowQuote   = '\x10'
+	ctcpQuoteC = '\\'
+)
+
+// ctcpCommands contains the CTCP commands that the client understands, they
+// are sent in the reply to a CLIENTINFO request
+const ctcpCommands = "ACTION CLIENTINFO DCC VERSION"
+
+// ctcpQuote quotes the CTCP payload so that it can be sent in a PRIVMSG or
+// NOTICE, first the CTCP level quoting is applied which escapes the CTCP
+// delimiter and backslash, after that the low level quoting escapes NUL,
+// CR, LF and the quote character itself.
+func ctcpQuote(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch r {
+		// CTCP level quoting
+		case '\x01':
+			b.WriteString(`\a`)
+		case ctcpQuoteC:
+			b.WriteString(`\\`)
+
+		// Low level quoting
+		case '\x00':
+			b.WriteRune(lowQuote)
+			b.WriteRune('0')
+		case '\n':
+			b.WriteRune(lowQuote)
+			b.WriteRune('n')
+		case '\r':
+			b.WriteRune(lowQuote)
+			b.WriteRune('r')
+		case lowQuote:
+			b.WriteRune(lowQuote)
+			b.WriteRune(lowQuote)
+
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// ctcpDequote reverses ctcpQuote, unknown escape sequences are replaced by
+// the escaped character.
+func ctcpDequote(s string) string {
+	// Low level dequoting
+	var low strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != lowQuote || i+1 == len(s) {
+			low.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case '0':
+			low.WriteByte('\x00')
+		case 'n':
+			low.WriteByte('\n')
+		case 'r':
+			low.WriteByte('\r')
+		default:
+			low.WriteByte(s[i])
+		}
+	}
+
+	// CTCP level dequoting
+	s = low.String()
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != ctcpQuoteC || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if s[i] == 'a' {
+			b.WriteByte('\x01')
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// ctcpMessage formats a CTCP message with the command and its arguments
+func ctcpMessage(command, args string) string {
+	if args == "" {
+		return ctcpDelim + ctcpQuote(command) + ctcpDelim
+	}
+	return ctcpDelim + ctcpQuote(command+" "+args) + ctcpDelim
+}
+
+// parseCTCP extracts the command and arguments from a CTCP message, ok is
+// false if the text isn't a CTCP message
+func parseCTCP(text string) (command, args string, ok bool) {
+	if len(text) < 2 || !strings.HasPrefix(text, ctcpDelim) {
+		return "", "", false
+	}
+
+	text = ctcpDequote(strings.TrimSuffix(text[1:], ctcpDelim))
+	p := strings.SplitN(text, " ", 2)
+	if len(p) == 2 {
+		return p[0], p[1], true
+	}
+	return p[0], "", true
+}
+
+// CTCP sends a CTCP request to the target
+func (c *Client) CTCP(target, command, args string) error {
+	return c.Privmsg(target, ctcpMessage(command, args))
+}
+
+// CTCPReply sends a CTCP reply to the target
+func (c *Client) CTCPReply(target, command, args string) error {
+	return c.Notice(target, ctcpMessage(command, args))
+}
+
+// CTCPClientInfo sends a CTCP CLIENTINFO request to the nick and returns the
+// CTCP commands that the client of the nick says that it supports
+func (c *Client) CTCPClientInfo(nick string) ([]string, error) {
+	c.infoMu.Lock()
+	key := c.casefold(nick)
+	c.infoMu.Unlock()
+
+	// The reply is a NOTICE from the nick, the server tells us if there
+	// is no such nick
+	w := c.wait(func(m *Message) bool {
+		c.infoMu.Lock()
+		defer c.infoMu.Unlock()
+
+		switch m.Command {
+		case "NOTICE":
+			cmd, _, ok := parseCTCP(m.Text())
+			return ok && strings.EqualFold(cmd, "CLIENTINFO") && c.casefold(m.Name) == key
+		case "401":
+			// <me> <nick> :No such nick/channel
+			return len(m.ParamsArray) > 1 && c.casefold(m.ParamsArray[1]) == key
+		}
+		return false
+	})
+	defer c.stopWait(w)
+
+	if err := c.CTCP(nick, "CLIENTINFO", ""); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m := <-w.ch:
+		if m.Command == "401" {
+			return nil, fmt.Errorf("CLIENTINFO to %s failed: %s", nick, m.Text())
+		}
+		_, args, _ := parseCTCP(m.Text())
+		return strings.Fields(args), nil
+
+	case <-c.clock.After(replyTimeout):
+		return nil, fmt.Errorf("timeout waiting for CLIENTINFO reply from %s", nick)
+	}
+}
+
+// handleClientInfo replies to CTCP CLIENTINFO requests that are sent to us
+func (c *Client) handleClientInfo(m *Message) {
+	cmd, _, ok := parseCTCP(m.Text())
+	if !ok || !strings.EqualFold(cmd, "CLIENTINFO") || len(m.ParamsArray) == 0 {
+		return
+	}
+
+	c.infoMu.Lock()
+	toUs := c.casefold(m.ParamsArray[0]) == c.casefold(c.currentNick)
+	c.infoMu.Unlock()
+
+	if toUs {
+		c.sendText("NOTICE", m.Name, ctcpMessage("CLIENTINFO", ctcpCommands))
+	}
+}
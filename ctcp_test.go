@@ -0,0 +1,109 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+// ctcpQuoteTests contains the unquoted and quoted test strings
+var ctcpQuoteTests = []struct {
+	name     string
+	unquoted string
+	quoted   string
+}{
+	{"plain", "VERSION", "VERSION"},
+	{"delimiter", "a\x01b", `a\ab`},
+	{"backslash", `a\b`, `a\\b`},
+	{"nul", "a\x00b", "a\x100b"},
+	{"newline", "a\nb", "a\x10nb"},
+	{"carriage return", "a\rb", "a\x10rb"},
+	{"quote", "a\x10b", "a\x10\x10b"},
+	{"mixed", "\x01\\\r\n\x00\x10", "\\a\\\\\x10r\x10n\x100\x10\x10"},
+}
+
+// TestCTCPQuote tests quoting and dequoting of CTCP payloads
+func TestCTCPQuote(t *testing.T) {
+	for _, qt := range ctcpQuoteTests {
+		t.Run(qt.name, func(t *testing.T) {
+			if q := ctcpQuote(qt.unquoted); q != qt.quoted {
+				t.Errorf("%s: quoted to %q, expected %q", qt.name, q, qt.quoted)
+			}
+
+			if u := ctcpDequote(qt.quoted); u != qt.unquoted {
+				t.Errorf("%s: dequoted to %q, expected %q", qt.name, u, qt.unquoted)
+			}
+		})
+	}
+}
+
+// TestSplitCTCP tests that each chunk of a split CTCP ACTION is a valid CTCP
+// message
+func TestSplitCTCP(t *testing.T) {
+	action := ctcpMessage("ACTION", strings.Repeat("waves ", 30))
+
+	chunks := splitMessage(action, 60)
+	if len(chunks) < 2 {
+		t.Fatalf("expected the message to be split, got %d chunks", len(chunks))
+	}
+
+	var words int
+	for _, s := range chunks {
+		if len(s) > 60 {
+			t.Errorf("chunk %q is %d bytes, expected at most 60", s, len(s))
+		}
+
+		cmd, args, ok := parseCTCP(s)
+		if !ok || cmd != "ACTION" || !strings.HasSuffix(s, ctcpDelim) {
+			t.Errorf("chunk %q is not a CTCP ACTION", s)
+		}
+		words += len(strings.Fields(args))
+	}
+	if words != 30 {
+		t.Errorf("expected 30 words in total, got %d", words)
+	}
+}
+
+// TestCTCPClientInfo tests the CLIENTINFO request and the reply to requests
+// from others
+func TestCTCPClientInfo(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		commands []string
+		err      error
+	}
+	results := make(chan result, 1)
+	go func() {
+		commands, err := c.CTCPClientInfo("Bar")
+		results <- result{commands, err}
+	}()
+
+	runScript(t, conn, tr, []string{
+		"CLI PRIVMSG Bar :\x01CLIENTINFO\x01",
+		"SRV :baz!~baz@127.0.0.1 NOTICE foo :\x01CLIENTINFO ACTION\x01",
+		"SRV :bar!~bar@127.0.0.1 NOTICE foo :\x01CLIENTINFO ACTION PING VERSION\x01",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG foo :\x01CLIENTINFO\x01",
+		"CLI NOTICE bar :\x01CLIENTINFO " + ctcpCommands + "\x01",
+	})
+
+	r := <-results
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+	if strings.Join(r.commands, " ") != "ACTION PING VERSION" {
+		t.Errorf("unexpected commands %v", r.commands)
+	}
+
+	go func() {
+		commands, err := c.CTCPClientInfo("qux")
+		results <- result{commands, err}
+	}()
+	runScript(t, conn, tr, []string{
+		"CLI PRIVMSG qux :\x01CLIENTINFO\x01",
+		"SRV :irc.example.net 401 foo qux :No such nick/channel",
+	})
+	if r := <-results; r.err == nil {
+		t.Errorf("expected an error for a missing nick")
+	}
+}
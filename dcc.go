@@ -0,0 +1,301 @@
+package irc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DCCSend is a DCC SEND offer, someone wants to send a file to us
+type DCCSend struct {
+	From     string
+	Filename string
+	IP       net.IP
+	Port     int
+	Size     int64
+}
+
+// OnDCCSend registers a function that is called when someone offers to send
+// a file to us, use AcceptDCCSend to receive the file
+func (c *Client) OnDCCSend(fn func(offer *DCCSend)) {
+	c.infoMu.Lock()
+	c.dccSendFns = append(c.dccSendFns, fn)
+	c.infoMu.Unlock()
+}
+
+// handleDCC parses DCC SEND offers and passes them to the OnDCCSend functions
+func (c *Client) handleDCC(m *Message) {
+	cmd, args, ok := parseCTCP(m.Text())
+	if !ok || cmd != "DCC" {
+		return
+	}
+
+	offer, err := parseDCCSend(args)
+	if err != nil {
+		c.log("%s: %s", m.Name, err.Error())
+		return
+	}
+	offer.From = m.Name
+
+	c.infoMu.Lock()
+	fns := make([]func(*DCCSend), len(c.dccSendFns))
+	copy(fns, c.dccSendFns)
+	c.infoMu.Unlock()
+
+	for _, fn := range fns {
+		go fn(offer)
+	}
+}
+
+// parseDCCSend parses the arguments of a DCC CTCP, SEND <filename> <ip>
+// <port> [<size>]. The filename can be quoted if it contains spaces and the
+// ip is either a dotted IP address or an IPv4 address encoded as an integer.
+func parseDCCSend(args string) (*DCCSend, error) {
+	if !strings.HasPrefix(args, "SEND ") {
+		return nil, fmt.Errorf("unsupported DCC request %s", args)
+	}
+	args = args[len("SEND "):]
+
+	// Extract the filename
+	var d DCCSend
+	if strings.HasPrefix(args, `"`) {
+		i := strings.Index(args[1:], `"`)
+		if i < 0 {
+			return nil, fmt.Errorf("malformed DCC SEND filename %s", args)
+		}
+		d.Filename = args[1 : i+1]
+		args = args[i+2:]
+	} else {
+		p := strings.SplitN(args, " ", 2)
+		d.Filename = p[0]
+		if len(p) == 2 {
+			args = p[1]
+		} else {
+			args = ""
+		}
+	}
+
+	p := strings.Fields(args)
+	if len(p) < 2 {
+		return nil, fmt.Errorf("malformed DCC SEND %s", args)
+	}
+
+	// The legacy format encodes the IPv4 address as an integer
+	if n, err := strconv.ParseUint(p[0], 10, 32); err == nil {
+		d.IP = make(net.IP, 4)
+		binary.BigEndian.PutUint32(d.IP, uint32(n))
+	} else if d.IP = net.ParseIP(p[0]); d.IP == nil {
+		return nil, fmt.Errorf("malformed DCC SEND ip %s", p[0])
+	}
+
+	port, err := strconv.Atoi(p[1])
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("malformed DCC SEND port %s", p[1])
+	}
+	d.Port = port
+
+	if len(p) > 2 {
+		if d.Size, err = strconv.ParseInt(p[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("malformed DCC SEND size %s", p[2])
+		}
+	}
+
+	return &d, nil
+}
+
+// AcceptDCCSend connects to the sender of the offer and writes the file to w,
+// the number of received bytes is acknowledged to the sender as the DCC
+// protocol requires. It returns when the whole file has been received or
+// when the sender closes the connection.
+func AcceptDCCSend(offer *DCCSend, w io.Writer) error {
+	conn, err := net.Dial("tcp", net.JoinHostPort(offer.IP.String(), strconv.Itoa(offer.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var received int64
+	buf := make([]byte, 32*1024)
+	ack := make([]byte, 4)
+	for offer.Size == 0 || received < offer.Size {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			received += int64(n)
+
+			// The acknowledgement is the total number of received
+			// bytes as a 32 bit integer in network byte order
+			binary.BigEndian.PutUint32(ack, uint32(received))
+			if _, werr := conn.Write(ack); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if offer.Size > 0 && received < offer.Size {
+		return fmt.Errorf("DCC SEND of %s ended after %d of %d bytes", offer.Filename, received, offer.Size)
+	}
+
+	return nil
+}
+
+// dccTimeout is the time we wait for the receiver to connect to us, and how
+// long a transfer may be idle before it is given up. It is only changed by
+// the tests.
+var dccTimeout = 2 * time.Minute
+
+// SendFile offers the file to the nick with DCC SEND and streams it when the
+// nick connects to us. It blocks until the receiver has acknowledged all the
+// data or until an error occurs. The address that is advertised and the
+// ports that are used can be set with WithDCCAddr and WithDCCPortRange.
+func (c *Client) SendFile(nick string, r io.Reader, name string, size int64) error {
+	ip, err := c.dccAddr()
+	if err != nil {
+		return err
+	}
+
+	ln, err := c.dccListen()
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	// Send the offer, IPv4 addresses are encoded as integers since that
+	// is what most clients understand
+	host := ip.String()
+	if ip4 := ip.To4(); ip4 != nil {
+		host = strconv.FormatUint(uint64(binary.BigEndian.Uint32(ip4)), 10)
+	}
+	if strings.Contains(name, " ") {
+		name = `"` + name + `"`
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if err := c.CTCP(nick, "DCC", fmt.Sprintf("SEND %s %s %d %d", name, host, port, size)); err != nil {
+		return err
+	}
+
+	// Wait for the receiver to connect
+	timeout := dccTimeout
+	ln.SetDeadline(time.Now().Add(timeout))
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Read the acknowledgements in the background, we are done when the
+	// receiver has acknowledged everything that we have sent
+	var lastAck uint32
+	acked := make(chan struct{}, 1)
+	errc := make(chan error, 1)
+	go func() {
+		ack := make([]byte, 4)
+		for {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			if _, err := io.ReadFull(conn, ack); err != nil {
+				errc <- err
+				return
+			}
+
+			atomic.StoreUint32(&lastAck, binary.BigEndian.Uint32(ack))
+			select {
+			case acked <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	// The deadlines are moved forward with each chunk, so the transfer is
+	// only given up if it has been idle for too long. Sending also counts
+	// for the acknowledgements since they follow the data.
+	var sent int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			conn.SetDeadline(time.Now().Add(timeout))
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			sent += int64(n)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The acknowledgement is a 32 bit integer, so it wraps for files that
+	// are larger than 4GB
+	for sent > 0 && atomic.LoadUint32(&lastAck) != uint32(sent) {
+		select {
+		case <-acked:
+		case err := <-errc:
+			// The receiver might have closed the connection
+			// right after the last acknowledgement
+			if atomic.LoadUint32(&lastAck) == uint32(sent) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dccAddr returns the address that we advertise in DCC offers
+func (c *Client) dccAddr() (net.IP, error) {
+	if c.dccIP != nil {
+		return c.dccIP, nil
+	}
+
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("unable to find our address, use WithDCCAddr")
+	}
+
+	addr := conn.LocalAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip, nil
+	}
+
+	return nil, fmt.Errorf("unable to find our address, use WithDCCAddr")
+}
+
+// dccListen listens on the first available port within the DCC port range
+func (c *Client) dccListen() (*net.TCPListener, error) {
+	if c.dccPortMin == 0 {
+		ln, err := net.ListenTCP("tcp", &net.TCPAddr{})
+		return ln, err
+	}
+
+	for p := c.dccPortMin; p <= c.dccPortMax; p++ {
+		if ln, err := net.ListenTCP("tcp", &net.TCPAddr{Port: p}); err == nil {
+			return ln, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no available port between %d and %d", c.dccPortMin, c.dccPortMax)
+}
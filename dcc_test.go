@@ -0,0 +1,196 @@
+package irc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// dccSendTests contains DCC SEND arguments and the expected offers
+var dccSendTests = []struct {
+	name  string
+	args  string
+	offer *DCCSend
+	err   bool
+}{
+	{
+		name:  "integer ip",
+		args:  "SEND foo.txt 2130706433 5000 1024",
+		offer: &DCCSend{Filename: "foo.txt", IP: net.IPv4(127, 0, 0, 1).To4(), Port: 5000, Size: 1024},
+	},
+	{
+		name:  "dotted ip",
+		args:  "SEND foo.txt 127.0.0.1 5000",
+		offer: &DCCSend{Filename: "foo.txt", IP: net.ParseIP("127.0.0.1"), Port: 5000},
+	},
+	{
+		name:  "quoted filename",
+		args:  `SEND "foo bar.txt" 2130706433 5000 1024`,
+		offer: &DCCSend{Filename: "foo bar.txt", IP: net.IPv4(127, 0, 0, 1).To4(), Port: 5000, Size: 1024},
+	},
+	{
+		name: "chat",
+		args: "CHAT chat 2130706433 5000",
+		err:  true,
+	},
+	{
+		name: "missing port",
+		args: "SEND foo.txt 2130706433",
+		err:  true,
+	},
+}
+
+// TestParseDCCSend tests parsing of DCC SEND offers
+func TestParseDCCSend(t *testing.T) {
+	for _, dt := range dccSendTests {
+		t.Run(dt.name, func(t *testing.T) {
+			offer, err := parseDCCSend(dt.args)
+			if dt.err != (err != nil) {
+				t.Fatalf("%s: unexpected error value %v", dt.name, err)
+			}
+			if !reflect.DeepEqual(offer, dt.offer) {
+				t.Errorf("%s: got %#v, expected %#v", dt.name, offer, dt.offer)
+			}
+		})
+	}
+}
+
+// TestAcceptDCCSend tests that the file is received and acknowledged
+func TestAcceptDCCSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	data := bytes.Repeat([]byte("foo"), 1000)
+	acked := make(chan uint32)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write(data)
+
+		// Read acknowledgements until everything has been acked
+		ack := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(conn, ack); err != nil {
+				return
+			}
+			if n := binary.BigEndian.Uint32(ack); n == uint32(len(data)) {
+				acked <- n
+				return
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	offer := &DCCSend{Filename: "foo.txt", IP: addr.IP, Port: addr.Port, Size: int64(len(data))}
+
+	var buf bytes.Buffer
+	if err := AcceptDCCSend(offer, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("received data doesn't match the sent data")
+	}
+	if n := <-acked; n != uint32(len(data)) {
+		t.Errorf("expected %d bytes to be acknowledged, got %d", len(data), n)
+	}
+}
+
+// TestSendFile tests that an offered file can be received
+func TestSendFile(t *testing.T) {
+	c, conn, tr := newTestClient(WithDCCAddr(net.ParseIP("127.0.0.1")))
+	defer conn.Server.Close()
+
+	data := bytes.Repeat([]byte("foo"), 1000)
+	errc := make(chan error)
+	go func() {
+		errc <- c.SendFile("bar", bytes.NewReader(data), "foo bar.txt", int64(len(data)))
+	}()
+
+	// Parse the offer that the client sent
+	l, _ := tr.ReadLine()
+	m, _ := parse(l)
+	cmd, args, ok := parseCTCP(m.Text())
+	if !ok || cmd != "DCC" {
+		t.Fatalf("expected a DCC CTCP, got %s", l)
+	}
+	offer, err := parseDCCSend(args)
+	if err != nil {
+		t.Fatalf("unable to parse the offer: %v", err)
+	}
+	if offer.Filename != "foo bar.txt" || offer.Size != int64(len(data)) {
+		t.Errorf("unexpected offer %#v", offer)
+	}
+
+	var buf bytes.Buffer
+	if err := AcceptDCCSend(offer, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("received data doesn't match the sent data")
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error from SendFile: %v", err)
+	}
+}
+
+// slowReader returns at most size bytes from each read after the delay
+type slowReader struct {
+	r     io.Reader
+	size  int
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	if len(p) > s.size {
+		p = p[:s.size]
+	}
+	return s.r.Read(p)
+}
+
+// TestSendFileSlow tests that a transfer may take longer than the timeout as
+// long as it isn't idle for that long
+func TestSendFileSlow(t *testing.T) {
+	defer func(d time.Duration) { dccTimeout = d }(dccTimeout)
+	dccTimeout = 200 * time.Millisecond
+
+	c, conn, tr := newTestClient(WithDCCAddr(net.ParseIP("127.0.0.1")))
+	defer conn.Server.Close()
+
+	data := bytes.Repeat([]byte("foo"), 1000)
+	r := &slowReader{r: bytes.NewReader(data), size: 300, delay: 50 * time.Millisecond}
+	errc := make(chan error)
+	go func() {
+		errc <- c.SendFile("bar", r, "foo.txt", int64(len(data)))
+	}()
+
+	l, _ := tr.ReadLine()
+	m, _ := parse(l)
+	_, args, _ := parseCTCP(m.Text())
+	offer, err := parseDCCSend(args)
+	if err != nil {
+		t.Fatalf("unable to parse the offer: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := AcceptDCCSend(offer, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("received data doesn't match the sent data")
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error from SendFile: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package irc
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// dedupKey returns the key that identifies the message when it is played
+// back again, the msgid if it has one or a hash of the server-time, the
+// prefix and the rest of the line otherwise. Messages without either can't
+// be told apart from new ones.
+func dedupKey(m *Message) (string, bool) {
+	if m.ID != "" {
+		return "id " + m.ID, true
+	}
+
+	t, ok := m.Tags["time"]
+	if !ok {
+		return "", false
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(t + "\x00" + m.Prefix + "\x00" + m.Command + " " + m.Params))
+	return "hash " + strconv.FormatUint(h.Sum64(), 36), true
+}
+
+// dedupMiddleware drops messages that have already been dispatched within
+// the dedup window, such as the messages that a bouncer plays back after a
+// reconnect
+func (c *Client) dedupMiddleware(next Handler) Handler {
+	return func(m *Message) {
+		if c.dedupWindow <= 0 {
+			next(m)
+			return
+		}
+
+		if key, ok := dedupKey(m); ok && c.seen(key) {
+			return
+		}
+		next(m)
+	}
+}
+
+// seen remembers the key and returns true if it has been seen within the
+// dedup window
+func (c *Client) seen(key string) bool {
+	c.dedupMu.Lock()
+	defer c.dedupMu.Unlock()
+
+	// Forget about the keys that are older than the window, at most once
+	// per window since there are a lot of them on busy networks
+	now := c.clock.Now()
+	if now.Sub(c.dedupPruned) > c.dedupWindow {
+		for k, at := range c.dedupSeen {
+			if now.Sub(at) > c.dedupWindow {
+				delete(c.dedupSeen, k)
+			}
+		}
+		c.dedupPruned = now
+	}
+
+	if at, ok := c.dedupSeen[key]; ok && now.Sub(at) <= c.dedupWindow {
+		return true
+	}
+	c.dedupSeen[key] = now
+	return false
+}
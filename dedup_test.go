@@ -0,0 +1,63 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDedupWindow tests that messages that are played back after a
+// reconnect are only dispatched once within the window
+func TestDedupWindow(t *testing.T) {
+	clock := newFakeClock()
+	c, conn, tr := newTestClient(WithClock(clock), WithDedupWindow(time.Minute))
+	defer conn.Server.Close()
+
+	texts := make(chan string, 10)
+	c.OnPrivmsg(func(from, target, text string, isPrivate bool) {
+		texts <- text
+	})
+
+	runScript(t, conn, tr, []string{
+		"SRV @msgid=a1 :bar!~bar@127.0.0.1 PRIVMSG #foo :one",
+		"SRV @msgid=a1 :bar!~bar@127.0.0.1 PRIVMSG #foo :one",
+		"SRV @time=2026-10-17T11:59:00.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :two",
+		"SRV @time=2026-10-17T11:59:00.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :two",
+		"SRV @time=2026-10-17T11:59:00.000Z :bar!~bar@127.0.0.1 PRIVMSG #foo :three",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :four",
+		"SRV :bar!~bar@127.0.0.1 PRIVMSG #foo :four",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	// The same msgid is dispatched again once the window has passed
+	clock.Advance(2 * time.Minute)
+	runScript(t, conn, tr, []string{
+		"SRV @msgid=a1 :bar!~bar@127.0.0.1 PRIVMSG #foo :one",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	received := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		select {
+		case text := <-texts:
+			received[text]++
+		case <-time.After(time.Second):
+			t.Fatalf("expected six messages, got %v", received)
+		}
+	}
+
+	expected := map[string]int{"one": 2, "two": 1, "three": 1, "four": 2}
+	for text, n := range expected {
+		if received[text] != n {
+			t.Errorf("got %v, expected %v", received, expected)
+			break
+		}
+	}
+
+	select {
+	case text := <-texts:
+		t.Errorf("unexpected message %s", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
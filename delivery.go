@@ -0,0 +1,131 @@
+package irc
+
+import (
+	"fmt"
+	"time"
+)
+
+// sendFailures contains the reasons for the numerics that the server replies
+// with when a PRIVMSG or NOTICE can't be delivered
+var sendFailures = map[string]string{
+	"401": "no such nick",
+	"403": "no such channel",
+	"404": "cannot send to channel",
+	"486": "only registered users can message this user",
+}
+
+// sendFailureWindow is how long after a message has been sent to a target
+// that a failure numeric for the target is attributed to the message
+const sendFailureWindow = time.Minute
+
+// SendError is returned by PrivmsgWait and passed to the functions that are
+// registered with OnSendFailed when the server refuses to deliver a message
+type SendError struct {
+	// Target is the nick or channel that the message was sent to
+	Target string
+
+	// Code is the numeric that the server replied with, e.g. 404
+	Code string
+
+	// Reason is the text that the server sent along with the numeric
+	Reason string
+}
+
+// Error returns the error as a string
+func (e *SendError) Error() string {
+	return fmt.Sprintf("unable to send to %s: %s (%s)", e.Target, sendFailures[e.Code], e.Reason)
+}
+
+// recordSend remembers that a message was sent to the target, so that a
+// failure for the target can be attributed to it
+func (c *Client) recordSend(target string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	now := c.clock.Now()
+	for k, at := range c.recentSends {
+		if now.Sub(at) > sendFailureWindow {
+			delete(c.recentSends, k)
+		}
+	}
+	c.recentSends[c.casefold(target)] = now
+}
+
+// sendFailure returns the error if the message is a failure numeric for a
+// target that we have sent a message to recently
+func (c *Client) sendFailure(m *Message) (*SendError, bool) {
+	// <me> <target> :<reason>
+	if sendFailures[m.Command] == "" || len(m.ParamsArray) < 2 {
+		return nil, false
+	}
+
+	c.infoMu.Lock()
+	at, ok := c.recentSends[c.casefold(m.ParamsArray[1])]
+	recent := ok && c.clock.Now().Sub(at) <= sendFailureWindow
+	c.infoMu.Unlock()
+	if !recent {
+		return nil, false
+	}
+
+	return &SendError{Target: m.ParamsArray[1], Code: m.Command, Reason: m.Text()}, true
+}
+
+// PrivmsgWait sends the message to the target and waits until we know that
+// the server accepted it, a *SendError is returned if the server refuses to
+// deliver it. The server doesn't confirm messages, so the message is
+// followed by a PING and the PONG means that the message was accepted. The
+// numerics that are covered are 401 (no such nick), 403 (no such channel),
+// 404 (cannot send to channel) and 486 (only registered users can message
+// this user). A 301 (the user is away) isn't a failure since the message is
+// delivered anyway.
+func (c *Client) PrivmsgWait(target, message string) error {
+	token := syncToken("privmsg")
+	w := c.wait(func(m *Message) bool {
+		if m.Command == "PONG" {
+			return m.Text() == token
+		}
+		err, ok := c.sendFailure(m)
+		if !ok {
+			return false
+		}
+
+		c.infoMu.Lock()
+		defer c.infoMu.Unlock()
+		return c.casefold(err.Target) == c.casefold(target)
+	})
+	defer c.stopWait(w)
+
+	if err := c.Privmsg(target, message); err != nil {
+		return err
+	}
+	if err := c.SendRaw("PING :" + token); err != nil {
+		return err
+	}
+
+	select {
+	case m := <-w.ch:
+		if m.Command == "PONG" {
+			return nil
+		}
+		err, _ := c.sendFailure(m)
+		return err
+
+	case <-c.clock.After(replyTimeout):
+		return fmt.Errorf("timeout waiting for the delivery to %s", target)
+	}
+}
+
+// OnSendFailed registers a function that is called when the server refuses
+// to deliver a PRIVMSG or NOTICE that we have sent recently, see PrivmsgWait
+// for the numerics that are covered
+func (c *Client) OnSendFailed(fn func(err *SendError)) {
+	h := func(m *Message) {
+		if err, ok := c.sendFailure(m); ok {
+			fn(err)
+		}
+	}
+
+	for code := range sendFailures {
+		c.Handle(code, h)
+	}
+}
@@ -0,0 +1,70 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPrivmsgWait tests that a rejected message is returned as an error and
+// that an accepted message isn't
+func TestPrivmsgWait(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	failed := make(chan *SendError, 2)
+	c.OnSendFailed(func(err *SendError) { failed <- err })
+
+	for _, tt := range []struct {
+		reply []string
+		code  string
+	}{
+		{[]string{"SRV :irc.example.net 404 foo #Foo :Cannot send to channel"}, "404"},
+		{nil, ""},
+	} {
+		errCh := make(chan error)
+		go func() { errCh <- c.PrivmsgWait("#foo", "hello") }()
+
+		if l, _ := tr.ReadLine(); l != "PRIVMSG #foo :hello" {
+			t.Errorf("unexpected line %s", l)
+		}
+		l, _ := tr.ReadLine()
+		if !strings.HasPrefix(l, "PING :") {
+			t.Fatalf("expected a PING, got %s", l)
+		}
+		runScript(t, conn, tr, append(tt.reply, "SRV :irc.example.net PONG irc.example.net :"+l[6:]))
+
+		err := <-errCh
+		if tt.code == "" {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			continue
+		}
+		if se, ok := err.(*SendError); !ok || se.Code != tt.code || se.Target != "#Foo" {
+			t.Errorf("expected a SendError with code %s, got %v", tt.code, err)
+		}
+	}
+
+	select {
+	case err := <-failed:
+		if err.Code != "404" {
+			t.Errorf("unexpected failure %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the failure wasn't reported")
+	}
+
+	// A 401 for a nick that we haven't sent anything to isn't a failed
+	// delivery, e.g. a WHOIS of a missing nick
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 401 foo bar :No such nick/channel",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+	select {
+	case err := <-failed:
+		t.Errorf("unexpected failure %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
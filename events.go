@@ -2,21 +2,207 @@ package irc
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
-// Handle registers a new event handler
+// Handle registers a new event handler, use * as event to handle all
+// messages. The * handlers of a message always return before the handlers of
+// its command are called.
 func (c *Client) Handle(event string, fn func(m *Message)) {
 	c.hub.Handle(event, fn)
 }
 
+// Hub returns the event hub of the client
+func (c *Client) Hub() *Hub {
+	return c.hub
+}
+
+// Use registers a middleware that wraps the dispatch of received messages to
+// the event handlers. The middleware can modify the message or drop it by not
+// calling next. Middleware is executed in the order it was registered, the
+// first registered middleware is the outermost one. It runs in the read loop,
+// so it should return quickly.
+func (c *Client) Use(mw func(next Handler) Handler) {
+	c.middlewareMu.Lock()
+	c.middleware = append(c.middleware, mw)
+	c.middlewareMu.Unlock()
+}
+
+// UseOut registers a transform that is applied to every line that is sent to
+// the server. It runs after the line has been formatted but before it is
+// encoded and truncated to the maximum line length, so the transform can
+// make the line longer. Transforms are applied in the order they were
+// registered.
+func (c *Client) UseOut(fn func(line string) string) {
+	c.middlewareMu.Lock()
+	c.outMiddleware = append(c.outMiddleware, fn)
+	c.middlewareMu.Unlock()
+}
+
+// transformOut applies the outgoing transforms to the line
+func (c *Client) transformOut(s string) string {
+	c.middlewareMu.Lock()
+	fns := c.outMiddleware
+	c.middlewareMu.Unlock()
+
+	for _, fn := range fns {
+		s = fn(s)
+	}
+	return s
+}
+
+// dispatch sends the message through the middleware chain to the event hub
+func (c *Client) dispatch(m *Message) {
+	// The innermost handler sends the message to the event hub, we use
+	// the command as event name and we also send the message to the
+	// wildcard event. The wildcard handlers always run to completion
+	// before the handlers of the command are called, so a catch-all
+	// handler sees the message before anyone acts on it. This is done in
+	// a separate goroutine to keep the read loop going.
+	h := Handler(func(m *Message) {
+		go func() {
+			c.hub.sendWait("*", m)
+			if !c.hub.Send(m.Command, m) {
+				c.hub.Send(unhandledEvent, m)
+			}
+		}()
+	})
+
+	c.middlewareMu.Lock()
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	c.middlewareMu.Unlock()
+
+	h(m)
+}
+
+// unhandledEvent is the event that messages without any handler for their
+// command are sent to
+const unhandledEvent = "*unhandled"
+
+// HandleUnhandled registers a handler that is called for messages that no
+// handler has been registered for, the * handlers don't count. The client
+// handles some commands on its own, such as PING and PRIVMSG, so those are
+// never passed to this handler.
+func (c *Client) HandleUnhandled(fn func(m *Message)) {
+	c.Handle(unhandledEvent, fn)
+}
+
+// HandleNumeric registers a new event handler for a numeric reply, an error
+// is returned if the code isn't a three digit numeric
+func (c *Client) HandleNumeric(code int, fn func(m *Message)) error {
+	if code < 0 || code > 999 {
+		return fmt.Errorf("invalid numeric %d", code)
+	}
+
+	c.Handle(fmt.Sprintf("%03d", code), fn)
+	return nil
+}
+
+// OnNickChange registers a function that is called when the server confirms
+// that our own nick has changed
+func (c *Client) OnNickChange(fn func(old, new string)) {
+	c.infoMu.Lock()
+	c.nickChangeFns = append(c.nickChangeFns, fn)
+	c.infoMu.Unlock()
+}
+
+// OnDisconnect registers a function that is called when the connection to
+// the server is lost, the reason is the text of the ERROR message that the
+// server sent before it closed the connection or the read error if it didn't
+// send one. It isn't called when we quit or reconnect on purpose.
+func (c *Client) OnDisconnect(fn func(reason string)) {
+	c.infoMu.Lock()
+	c.disconnectFns = append(c.disconnectFns, fn)
+	c.infoMu.Unlock()
+}
+
+// OnJoin registers a function that is called when someone joins a channel,
+// including us. The account and real name are only known if the
+// extended-join capability is enabled, the account is empty if the user
+// isn't logged in.
+func (c *Client) OnJoin(fn func(nick, channel, account, realname string)) {
+	c.Handle("JOIN", func(m *Message) {
+		// JOIN <channel> or JOIN <channel> <account> :<real name>
+		if len(m.ParamsArray) == 0 {
+			return
+		}
+		channel := strings.TrimPrefix(m.ParamsArray[0], prefix)
+
+		var account, realname string
+		if len(m.ParamsArray) > 1 {
+			account = m.ParamsArray[1]
+			if account == "*" {
+				account = ""
+			}
+			realname = m.Text()
+		}
+		fn(m.Name, channel, account, realname)
+	})
+}
+
+// OnPart registers a function that is called when someone leaves a channel,
+// including us
+func (c *Client) OnPart(fn func(nick, channel, reason string)) {
+	c.Handle("PART", func(m *Message) {
+		// PART <channel> [:<reason>]
+		if len(m.ParamsArray) == 0 {
+			return
+		}
+
+		var reason string
+		if len(m.ParamsArray) > 1 {
+			reason = m.Text()
+		}
+		fn(m.Name, strings.TrimPrefix(m.ParamsArray[0], prefix), reason)
+	})
+}
+
+// OnQuit registers a function that is called when someone quits
+func (c *Client) OnQuit(fn func(nick, reason string)) {
+	c.Handle("QUIT", func(m *Message) {
+		fn(m.Name, m.Text())
+	})
+}
+
+// OnPrivmsg registers a function that is called for each PRIVMSG that we
+// receive, isPrivate is true if it was sent to us rather than to a channel.
+// CTCP messages, such as ACTION, aren't passed to the function.
+func (c *Client) OnPrivmsg(fn func(from, target, text string, isPrivate bool)) {
+	c.Handle("PRIVMSG", func(m *Message) {
+		// PRIVMSG <target> :<text>
+		if len(m.ParamsArray) == 0 {
+			return
+		}
+		text := m.Text()
+		if _, _, ok := parseCTCP(text); ok {
+			return
+		}
+
+		target := m.ParamsArray[0]
+		c.infoMu.Lock()
+		isPrivate := c.casefold(target) == c.casefold(c.currentNick)
+		c.infoMu.Unlock()
+
+		fn(m.Name, target, text, isPrivate)
+	})
+}
+
 // coreEvents setups event handlers for the most common tasks that everyone most likely wants
 func (c *Client) coreEvents() {
 	// Handle PING PONG
+	// This handles the PINGs that the server sends to us, PINGs that we
+	// send with Ping are answered with PONG and handled by the read loop.
 	// We also try to reclaim our nick on each PING from the server
 	c.Handle("PING", func(m *Message) {
-		// Send PONG
-		c.Sendf("PONG %s", m.Params)
+		// Send PONG, all the parameters are echoed back as is so
+		// both the PING :<server> and PING <token> <token> forms
+		// are handled
+		if !c.noAutoPong {
+			c.send("PONG " + m.Params)
+		}
 
 		// Try to reclaim our nick on each PING
 		c.ReclaimNick()
@@ -25,60 +211,82 @@ func (c *Client) coreEvents() {
 	// If the nick that PARTs is our configured nick we'll reclaim it.
 	c.Handle("QUIT", func(m *Message) {
 		if m.Name == c.nick {
-			// Acquire lock
-			c.infoMu.Lock()
-
-			// Send NICK command
-			c.Nick(c.nick)
-
-			// Set current nick to what we just changed it to be
-			c.currentNick = c.nick
-
-			// Release the lock
-			c.infoMu.Unlock()
+			// Send NICK command, the current nick is updated when
+			// the server confirms the change
+			c.send("NICK " + c.nick)
 		}
 	})
 
+	// The same goes for a nick that is lost in a netsplit
+	c.Handle("NETSPLIT", c.handleNetsplit)
+
 	// 401 is returned by the server after a WHOIS request if the nick is not in use
 	// Let's verify if the WHOIS request was made from a nick reclaim attempt
 	c.Handle("401", func(m *Message) {
 		// Our current nick is not the nick that we want
-		// Let's acquire a lock and change it
+		// Let's change it
 		if m.Params == fmt.Sprintf("%s %s :No such nick or channel name", c.currentNick, c.nick) ||
 			m.Params == fmt.Sprintf("%s %s :No such nick", c.currentNick, c.nick) {
-			// Acquire lock
-			c.infoMu.Lock()
-
-			// Send NICK command
-			c.Nick(c.nick)
-
-			// Set current nick to what we just changed it to be
-			c.currentNick = c.nick
-
-			// Release the lock
-			c.infoMu.Unlock()
+			// Send NICK command, the current nick is updated when
+			// the server confirms the change
+			c.send("NICK " + c.nick)
 		}
 	})
 
 	// Things to do after a successful connect
+	// The read loop marks the client as registered before this handler is
+	// called, so this is the place for all the actions that the client
+	// performs on its own once it is connected.
 	c.Handle("001", func(m *Message) {
+		// Identify with NickServ before anything else and take our
+		// nick back if someone else is using it
+		if c.nickServPassword != "" {
+			c.identify()
+			c.ReclaimNick()
+		}
+
+		// We are idle from now on until the user sends something
+		c.startAutoAway()
+
+		// Keep on trying to reclaim the nick if we are asked to
+		if c.autoReclaim > 0 {
+			go c.autoReclaimNick()
+		}
+
 		// The post connect messages and modes should occur before
 		// joining any channels.
 		for _, pcm := range c.postConnectMessages {
-			c.Privmsg(pcm.target, pcm.message)
+			c.sendText("PRIVMSG", pcm.target, pcm.message)
 		}
 		for _, m := range c.postConnectModes {
-			c.Sendf("MODE %s %s", c.currentNick, m)
+			c.send(fmt.Sprintf("MODE %s %s", c.currentNick, m))
+		}
+		if len(c.userModes) > 0 {
+			c.send(fmt.Sprintf("MODE %s %s", c.GetNick(), combineModes(c.userModes)))
 		}
 
 		// To make sure all the messages and modes has been
 		// successfully applied before we join a channel we'll sleep
 		// for a short while.
-		time.Sleep(3 * time.Second)
+		select {
+		case <-c.clock.After(3 * time.Second):
+		case <-c.done:
+			return
+		}
 
-		for _, ch := range c.channels {
-			c.Sendf("JOIN %s", ch)
+		// Join all configured channels and all channels that we were
+		// in before a reconnect.
+		c.infoMu.Lock()
+		channels := make([]string, len(c.channels))
+		copy(channels, c.channels)
+		c.infoMu.Unlock()
+
+		for _, ch := range channels {
+			c.send("JOIN " + ch)
 		}
+
+		// Send everything that was queued while we were disconnected
+		c.flushSendQueue()
 	})
 
 	// Handle CTCP version requests
@@ -86,20 +294,51 @@ func (c *Client) coreEvents() {
 		// Make sure that the CTCP VERSION request is made to our current nick
 		if m.Params == fmt.Sprintf("%s :\x01VERSION\x01", c.currentNick) {
 			// Reply
-			c.Noticef(m.Name, "\x01VERSION %s\x01", c.version)
+			c.sendText("NOTICE", m.Name, ctcpMessage("VERSION", c.version))
 		}
 	})
 
+	// Dispatch bot commands
+	c.Handle("PRIVMSG", c.handleCommand)
+
+	// Tell others which CTCP commands we understand
+	c.Handle("PRIVMSG", c.handleClientInfo)
+
+	// Handle channels that require a registered nick
+	c.Handle("477", c.handleNeedRegisteredNick)
+
+	// Handle capability negotiation
+	c.Handle("CAP", c.handleCap)
+
+	// Handle SASL authentication
+	c.Handle("AUTHENTICATE", c.handleAuthenticate)
+	for _, n := range []string{"903", "904", "905", "906", "907"} {
+		c.Handle(n, c.handleSASLResult)
+	}
+
+	// Rejoin channels that we are kicked from
+	c.Handle("KICK", c.handleKick)
+
+	// Handle DCC SEND offers
+	c.Handle("PRIVMSG", c.handleDCC)
+
 	// Handle nick in use
 	c.Handle("433", func(m *Message) {
 		// Acquire lock
 		c.infoMu.Lock()
 
+		// Once we are registered the server keeps our current nick
+		// when a nick change fails, so there is nothing to do
+		if c.registered {
+			c.infoMu.Unlock()
+			return
+		}
+
 		// Update the nick
 		c.currentNick = fmt.Sprintf("%s_", c.currentNick)
 
 		// Send nick to server
-		c.Nick(c.currentNick)
+		c.send("NICK " + c.currentNick)
 
 		// Release the lock
 		c.infoMu.Unlock()
@@ -1,8 +1,9 @@
 module github.com/osm/irc
 
 require (
-	github.com/osm/event v1.0.0
 	github.com/osm/ww v1.0.0
+	go.uber.org/goleak v1.1.12
+	golang.org/x/text v0.3.8
 )
 
 go 1.13
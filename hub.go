@@ -0,0 +1,98 @@
+package irc
+
+import (
+	"sync"
+)
+
+// Handler is a function that handles a message
+type Handler func(m *Message)
+
+// handler is a registered handler and the id that it can be removed with
+type handler struct {
+	id int
+	fn Handler
+}
+
+// Hub dispatches messages to the handlers that are registered for an event.
+// All methods are safe for concurrent use. Every handler is executed in its
+// own goroutine, so there is no guarantee about the order in which the
+// handlers of an event are run.
+type Hub struct {
+	handlers map[string][]handler
+	nextID   int
+	mu       sync.Mutex
+}
+
+// NewHub creates a new event hub
+func NewHub() *Hub {
+	return &Hub{
+		handlers: make(map[string][]handler),
+	}
+}
+
+// Handle registers a handler for an event and returns an id that can be
+// passed to Remove to unregister the handler again
+func (h *Hub) Handle(event string, fn Handler) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	h.handlers[event] = append(h.handlers[event], handler{h.nextID, fn})
+	return h.nextID
+}
+
+// Remove unregisters the handler with the given id from the event
+func (h *Hub) Remove(event string, id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hs := h.handlers[event]
+	for i := range hs {
+		if hs[i].id == id {
+			h.handlers[event] = append(hs[:i:i], hs[i+1:]...)
+			break
+		}
+	}
+
+	if len(h.handlers[event]) == 0 {
+		delete(h.handlers, event)
+	}
+}
+
+// Send dispatches the message to all handlers of the event, it returns
+// false if there are no handlers registered for the event.
+func (h *Hub) Send(event string, m *Message) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hs, ok := h.handlers[event]
+	if !ok {
+		return false
+	}
+
+	for _, hd := range hs {
+		go hd.fn(m)
+	}
+
+	return true
+}
+
+// sendWait dispatches the message to all handlers of the event and waits
+// until all of them have returned
+func (h *Hub) sendWait(event string, m *Message) bool {
+	h.mu.Lock()
+	hs, ok := h.handlers[event]
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(hs))
+	for _, hd := range hs {
+		go func(fn Handler) {
+			defer wg.Done()
+			fn(m)
+		}(hd.fn)
+	}
+	wg.Wait()
+
+	return ok
+}
@@ -0,0 +1,53 @@
+package irc
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestHub tests that handlers are called and can be removed
+func TestHub(t *testing.T) {
+	h := NewHub()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var calls []string
+
+	id := h.Handle("PING", func(m *Message) {
+		mu.Lock()
+		calls = append(calls, "first")
+		mu.Unlock()
+		wg.Done()
+	})
+	h.Handle("PING", func(m *Message) {
+		mu.Lock()
+		calls = append(calls, "second")
+		mu.Unlock()
+		wg.Done()
+	})
+
+	// Both handlers should be called
+	wg.Add(2)
+	if !h.Send("PING", &Message{Command: "PING"}) {
+		t.Errorf("Send should report that there are handlers for PING")
+	}
+	wg.Wait()
+	if len(calls) != 2 {
+		t.Errorf("expected two handlers to be called, got %d", len(calls))
+	}
+
+	// Only the second handler should be called after the first one is removed
+	calls = nil
+	h.Remove("PING", id)
+	wg.Add(1)
+	h.Send("PING", &Message{Command: "PING"})
+	wg.Wait()
+	if len(calls) != 1 || calls[0] != "second" {
+		t.Errorf("expected only the second handler to be called, got %v", calls)
+	}
+
+	// There are no handlers for PONG
+	if h.Send("PONG", &Message{Command: "PONG"}) {
+		t.Errorf("Send should report that there are no handlers for PONG")
+	}
+}
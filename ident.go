@@ -0,0 +1,107 @@
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultIdentAddr is the address that the ident responder listens on, RFC
+// 1413 uses port 113
+const defaultIdentAddr = ":113"
+
+// identTimeout is how long we wait for an ident query once the server has
+// connected to the responder
+const identTimeout = 30 * time.Second
+
+// startIdent starts the ident responder if it is enabled and isn't running
+// already, a failure to listen is logged but doesn't stop us from connecting
+func (c *Client) startIdent() {
+	if c.identUser == "" {
+		return
+	}
+
+	c.identMu.Lock()
+	defer c.identMu.Unlock()
+	if c.identLn != nil {
+		return
+	}
+
+	addr := c.identAddr
+	if addr == "" {
+		addr = defaultIdentAddr
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		c.log("unable to start the ident responder: %s", err.Error())
+		return
+	}
+	c.identLn = ln
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go c.handleIdent(conn)
+		}
+	}()
+}
+
+// stopIdent stops the ident responder if it is running
+func (c *Client) stopIdent() {
+	c.identMu.Lock()
+	defer c.identMu.Unlock()
+
+	if c.identLn != nil {
+		c.identLn.Close()
+		c.identLn = nil
+	}
+}
+
+// handleIdent answers an ident query, we only tell the user of our own
+// connection to the IRC server
+func (c *Client) handleIdent(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(identTimeout))
+
+	// <port on our side> , <port on the server side>
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	p := strings.Split(strings.TrimSpace(line), ",")
+	if len(p) != 2 {
+		return
+	}
+	local, err1 := strconv.Atoi(strings.TrimSpace(p[0]))
+	remote, err2 := strconv.Atoi(strings.TrimSpace(p[1]))
+	if err1 != nil || err2 != nil {
+		return
+	}
+
+	reply := "ERROR : NO-USER"
+	if c.ownsPorts(local, remote) {
+		reply = "USERID : UNIX : " + c.identUser
+	}
+	fmt.Fprintf(conn, "%d , %d : %s\r\n", local, remote, reply)
+}
+
+// ownsPorts reports whether our connection to the IRC server uses the local
+// and remote ports
+func (c *Client) ownsPorts(local, remote int) bool {
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+	if conn == nil {
+		return false
+	}
+
+	l, ok1 := conn.LocalAddr().(*net.TCPAddr)
+	r, ok2 := conn.RemoteAddr().(*net.TCPAddr)
+	return ok1 && ok2 && l.Port == local && r.Port == remote
+}
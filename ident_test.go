@@ -0,0 +1,74 @@
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIdent tests that the ident responder only tells the user of our own
+// connection
+func TestIdent(t *testing.T) {
+	srv, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	c := NewClient(WithAddr(srv.Addr().String()), WithNick("foo"), WithIdent("bar"), WithIdentAddr("127.0.0.1:0"))
+	go c.Connect()
+
+	conn, err := srv.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	bufio.NewReader(conn).ReadString('\n')
+
+	c.identMu.Lock()
+	identAddr := c.identLn.Addr().String()
+	c.identMu.Unlock()
+
+	// The ports are seen from the side of the client
+	local := conn.RemoteAddr().(*net.TCPAddr).Port
+	remote := conn.LocalAddr().(*net.TCPAddr).Port
+
+	for query, expected := range map[string]string{
+		fmt.Sprintf("%d, %d", local, remote):   fmt.Sprintf("%d , %d : USERID : UNIX : bar", local, remote),
+		fmt.Sprintf("%d, %d", local, remote+1): fmt.Sprintf("%d , %d : ERROR : NO-USER", local, remote+1),
+	} {
+		ident, err := net.Dial("tcp", identAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(ident, "%s\r\n", query)
+		reply, _ := bufio.NewReader(ident).ReadString('\n')
+		ident.Close()
+
+		if strings.TrimSpace(reply) != expected {
+			t.Errorf("got reply %q to %q, expected %q", reply, query, expected)
+		}
+	}
+
+	// The responder is stopped when we quit
+	c.Quit("bye")
+	conn.Close()
+	for i := 0; ; i++ {
+		c.identMu.Lock()
+		stopped := c.identLn == nil
+		c.identMu.Unlock()
+		if stopped {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expected the ident responder to be stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := net.Dial("tcp", identAddr); err == nil {
+		t.Errorf("expected the ident port to be closed")
+	}
+}
@@ -0,0 +1,63 @@
+package irc
+
+import (
+	"fmt"
+)
+
+// Ignore drops all PRIVMSG and NOTICE messages, including CTCP requests and
+// replies, from senders that match the mask before they reach the event
+// handlers. The mask is matched against nick!user@host and may contain the
+// wildcards * and ?.
+func (c *Client) Ignore(mask string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	for _, m := range c.ignores {
+		if m == mask {
+			return
+		}
+	}
+	c.ignores = append(c.ignores, mask)
+}
+
+// Unignore removes the mask from the ignore list
+func (c *Client) Unignore(mask string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	for i, m := range c.ignores {
+		if m == mask {
+			c.ignores = append(c.ignores[:i], c.ignores[i+1:]...)
+			return
+		}
+	}
+}
+
+// isIgnored returns true if the sender of the message is ignored
+func (c *Client) isIgnored(m *Message) bool {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	if len(c.ignores) == 0 || m.Name == "" {
+		return false
+	}
+
+	hostmask := c.casefold(fmt.Sprintf("%s!%s@%s", m.Name, m.User, m.Host))
+	for _, mask := range c.ignores {
+		if matchMask(c.casefold(mask), hostmask) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoreMiddleware drops messages from ignored senders
+func (c *Client) ignoreMiddleware(next Handler) Handler {
+	return func(m *Message) {
+		if (m.Command == "PRIVMSG" || m.Command == "NOTICE") && c.isIgnored(m) {
+			return
+		}
+		next(m)
+	}
+}
@@ -0,0 +1,213 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ServerInfo contains the reply to a VERSION request
+type ServerInfo struct {
+	// Version is the version of the server software
+	Version string
+
+	// Server is the name of the server that replied
+	Server string
+
+	// Comments contains any additional comments about the version
+	Comments string
+
+	// ISupport contains the ISUPPORT tokens that the server sent along
+	// with the version, it is empty when a remote server is queried
+	ISupport map[string]string
+}
+
+// query sends the lines to the server and collects all replies that match
+// until a reply that done returns true for is received, the final reply is
+// included. ERR_NOSUCHSERVER is returned as an error.
+func (c *Client) query(match, done func(m *Message) bool, lines ...string) ([]*Message, error) {
+	w := c.wait(func(m *Message) bool {
+		return m.Command == "402" || match(m)
+	})
+	defer c.stopWait(w)
+
+	for _, l := range lines {
+		if err := c.SendRaw(l); err != nil {
+			return nil, err
+		}
+	}
+	line := lines[0]
+
+	var msgs []*Message
+	timeout := c.clock.After(replyTimeout)
+	for {
+		select {
+		case m := <-w.ch:
+			if m.Command == "402" {
+				return nil, fmt.Errorf("%s failed: %s", line, m.Text())
+			}
+
+			msgs = append(msgs, m)
+			if done(m) {
+				return msgs, nil
+			}
+
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for reply to %s", line)
+		}
+	}
+}
+
+// syncToken returns a unique token for a PING that is sent after a request
+// whose replies don't have an end marker, the PONG marks the end instead
+func syncToken(name string) string {
+	return name + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Version sends a VERSION request to the target server, or to the server that
+// we are connected to if target is empty, and returns the reply. The replies
+// are dispatched to the 351 and 005 event handlers as usual.
+func (c *Client) Version(target string) (*ServerInfo, error) {
+	line := "VERSION"
+	if target != "" {
+		line += " " + target
+	}
+
+	// The server sends the ISUPPORT tokens after RPL_VERSION without
+	// telling us when it is done, so we'll follow the request with a PING
+	// when we ask our own server, the PONG marks the end of the reply
+	lines := []string{line}
+	token := syncToken("version")
+	if target == "" {
+		lines = append(lines, "PING :"+token)
+	}
+
+	msgs, err := c.query(func(m *Message) bool {
+		return m.Command == "351" || m.Command == "005" || m.Command == "PONG"
+	}, func(m *Message) bool {
+		if target != "" {
+			return m.Command == "351"
+		}
+		return m.Command == "PONG" && m.Text() == token
+	}, lines...)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{ISupport: make(map[string]string)}
+	for _, m := range msgs {
+		switch m.Command {
+		case "351":
+			// <me> <version> <server> :<comments>
+			if len(m.ParamsArray) > 2 {
+				info.Version = m.ParamsArray[1]
+				info.Server = m.ParamsArray[2]
+				info.Comments = m.Text()
+			}
+		case "005":
+			updateISupport(info.ISupport, m)
+		}
+	}
+
+	return info, nil
+}
+
+// Time sends a TIME request to the target server, or to the server that we
+// are connected to if target is empty, and returns the local time of the
+// server as it was sent by the server
+func (c *Client) Time(target string) (string, error) {
+	line := "TIME"
+	if target != "" {
+		line += " " + target
+	}
+
+	msgs, err := c.query(func(m *Message) bool {
+		return m.Command == "391"
+	}, func(m *Message) bool {
+		return true
+	}, line)
+	if err != nil {
+		return "", err
+	}
+
+	// <me> <server> :<time>
+	return msgs[0].Text(), nil
+}
+
+// Admin sends an ADMIN request and returns the administrative information
+// about the server, one line for each of the 256 to 259 replies
+func (c *Client) Admin() ([]string, error) {
+	msgs, err := c.query(func(m *Message) bool {
+		switch m.Command {
+		case "256", "257", "258", "259":
+			return true
+		}
+		return false
+	}, func(m *Message) bool {
+		return m.Command == "259"
+	}, "ADMIN")
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		lines = append(lines, m.Text())
+	}
+	return lines, nil
+}
+
+// Motd sends a MOTD request to the target server, or to the server that we
+// are connected to if target is empty, and returns the lines of the message
+// of the day. An error is returned if the server doesn't have a MOTD.
+func (c *Client) Motd(target string) ([]string, error) {
+	line := "MOTD"
+	if target != "" {
+		line += " " + target
+	}
+
+	msgs, err := c.query(func(m *Message) bool {
+		switch m.Command {
+		case "372", "375", "376", "422":
+			return true
+		}
+		return false
+	}, func(m *Message) bool {
+		return m.Command == "376" || m.Command == "422"
+	}, line)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, m := range msgs {
+		switch m.Command {
+		case "372":
+			lines = append(lines, m.Text())
+		case "422":
+			return nil, fmt.Errorf("%s failed: %s", line, m.Text())
+		}
+	}
+	return lines, nil
+}
+
+// Info sends an INFO request and returns the lines that the server replied
+// with
+func (c *Client) Info() ([]string, error) {
+	msgs, err := c.query(func(m *Message) bool {
+		return m.Command == "371" || m.Command == "374"
+	}, func(m *Message) bool {
+		return m.Command == "374"
+	}, "INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, m := range msgs {
+		if m.Command == "371" {
+			lines = append(lines, m.Text())
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,189 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestVersion tests that the VERSION reply and the ISUPPORT tokens that
+// follow it are aggregated
+func TestVersion(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		info *ServerInfo
+		err  error
+	}
+	ch := make(chan result)
+	go func() {
+		info, err := c.Version("")
+		ch <- result{info, err}
+	}()
+
+	if l, _ := tr.ReadLine(); l != "VERSION" {
+		t.Errorf("unexpected line %s", l)
+	}
+	l, _ := tr.ReadLine()
+	if !strings.HasPrefix(l, "PING :") {
+		t.Fatalf("expected a PING, got %s", l)
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 351 foo ircd-1.0 irc.example.net :TS6",
+		"SRV :irc.example.net 005 foo NETWORK=Example CHANTYPES=# :are supported by this server",
+		"SRV :irc.example.net PONG irc.example.net :" + l[6:],
+	})
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+	if r.info.Version != "ircd-1.0" || r.info.Server != "irc.example.net" || r.info.Comments != "TS6" {
+		t.Errorf("unexpected server info %#v", r.info)
+	}
+	if r.info.ISupport["NETWORK"] != "Example" || r.info.ISupport["CHANTYPES"] != "#" {
+		t.Errorf("unexpected ISUPPORT tokens %v", r.info.ISupport)
+	}
+	if network := c.Network(); network != "Example" {
+		t.Errorf("expected network Example, got %s", network)
+	}
+}
+
+// TestTime tests the TIME request and the error for an unknown server
+func TestTime(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		time string
+		err  error
+	}
+	ch := make(chan result)
+	go func() {
+		s, err := c.Time("")
+		ch <- result{s, err}
+	}()
+	runScript(t, conn, tr, []string{
+		"CLI TIME",
+		"SRV :irc.example.net 391 foo irc.example.net :Saturday October 17 2026 -- 12:00:00 +00:00",
+	})
+	if r := <-ch; r.err != nil || r.time != "Saturday October 17 2026 -- 12:00:00 +00:00" {
+		t.Errorf("unexpected result %v, %v", r.time, r.err)
+	}
+
+	go func() {
+		s, err := c.Time("irc.invalid")
+		ch <- result{s, err}
+	}()
+	runScript(t, conn, tr, []string{
+		"CLI TIME irc.invalid",
+		"SRV :irc.example.net 402 foo irc.invalid :No such server",
+	})
+	if r := <-ch; r.err == nil {
+		t.Errorf("expected an error for an unknown server")
+	}
+}
+
+// TestLusers tests that the LUSERS replies are aggregated and that missing
+// replies are handled
+func TestLusers(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		lusers *Lusers
+		err    error
+	}
+	ch := make(chan result)
+	go func() {
+		l, err := c.Lusers()
+		ch <- result{l, err}
+	}()
+
+	if l, _ := tr.ReadLine(); l != "LUSERS" {
+		t.Errorf("unexpected line %s", l)
+	}
+	l, _ := tr.ReadLine()
+	if !strings.HasPrefix(l, "PING :") {
+		t.Fatalf("expected a PING, got %s", l)
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 251 foo :There are 10 users and 90 invisible on 3 servers",
+		"SRV :irc.example.net 252 foo 4 :operator(s) online",
+		"SRV :irc.example.net 254 foo 25 :channels formed",
+		"SRV :irc.example.net 255 foo :I have 40 clients and 1 servers",
+		"SRV :irc.example.net 265 foo 40 50 :Current local users 40, max 50",
+		"SRV :irc.example.net 266 foo :Current global users 100, max 120",
+		"SRV :irc.example.net PONG irc.example.net :" + l[6:],
+	})
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+	expected := &Lusers{
+		Users:          10,
+		Invisible:      90,
+		Servers:        3,
+		Operators:      4,
+		Channels:       25,
+		LocalClients:   40,
+		LocalServers:   1,
+		LocalUsers:     40,
+		MaxLocalUsers:  50,
+		GlobalUsers:    100,
+		MaxGlobalUsers: 120,
+	}
+	if *r.lusers != *expected {
+		t.Errorf("got %#v, expected %#v", r.lusers, expected)
+	}
+}
+
+// TestMotd tests that the MOTD lines are collected and that a missing MOTD
+// is an error
+func TestMotd(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	type result struct {
+		lines []string
+		err   error
+	}
+	ch := make(chan result)
+	go func() {
+		lines, err := c.Motd("")
+		ch <- result{lines, err}
+	}()
+
+	runScript(t, conn, tr, []string{
+		"CLI MOTD",
+		"SRV :irc.example.net 375 foo :- irc.example.net Message of the Day -",
+		"SRV :irc.example.net 372 foo :- Welcome",
+		"SRV :irc.example.net 372 foo :- Be nice",
+		"SRV :irc.example.net 376 foo :End of /MOTD command.",
+	})
+
+	r := <-ch
+	if r.err != nil {
+		t.Fatalf("unexpected error: %v", r.err)
+	}
+	if strings.Join(r.lines, "|") != "- Welcome|- Be nice" {
+		t.Errorf("unexpected MOTD %q", r.lines)
+	}
+
+	go func() {
+		lines, err := c.Motd("leaf.example.net")
+		ch <- result{lines, err}
+	}()
+
+	runScript(t, conn, tr, []string{
+		"CLI MOTD leaf.example.net",
+		"SRV :leaf.example.net 422 foo :MOTD File is missing",
+	})
+
+	if r := <-ch; r.err == nil {
+		t.Errorf("expected an error for a missing MOTD")
+	}
+}
@@ -0,0 +1,126 @@
+// Package irctest provides a scripted IRC server for testing code that uses
+// the irc package.
+//
+// A script is a list of lines that start with either SRV or CLI. SRV lines
+// are sent by the server to the client and CLI lines are the lines that the
+// client is expected to send, in that order:
+//
+//	conn, srv := irctest.Pipe()
+//	c := irc.NewClient(irc.WithConn(conn), irc.WithNick("foo"))
+//	go c.Connect()
+//
+//	err := srv.Run(
+//		"CLI CAP LS 302",
+//		"CLI USER foo * * :foo",
+//		"CLI NICK foo",
+//		"SRV :irc.example.net 001 foo :Welcome",
+//	)
+package irctest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long the server waits for each line from the client
+const DefaultTimeout = 5 * time.Second
+
+// Server is a scripted IRC server that talks to a client over a connection
+type Server struct {
+	// Timeout is how long the server waits for each line from the client
+	Timeout time.Duration
+
+	conn net.Conn
+	r    *textproto.Reader
+}
+
+// NewServer creates a server that talks to the client over the connection
+func NewServer(conn net.Conn) *Server {
+	return &Server{
+		Timeout: DefaultTimeout,
+		conn:    conn,
+		r:       textproto.NewReader(bufio.NewReader(conn)),
+	}
+}
+
+// Pipe creates a server and returns the connection that the client should
+// use to talk to it
+func Pipe() (net.Conn, *Server) {
+	client, server := net.Pipe()
+	return client, NewServer(server)
+}
+
+// Send sends the line to the client, CR-LF is appended to it
+func (s *Server) Send(line string) error {
+	_, err := fmt.Fprint(s.conn, line+"\r\n")
+	return err
+}
+
+// ReadLine reads the next line that the client sends
+func (s *Server) ReadLine() (string, error) {
+	if s.Timeout > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(s.Timeout))
+		defer s.conn.SetReadDeadline(time.Time{})
+	}
+	return s.r.ReadLine()
+}
+
+// Expect reads the next line that the client sends and returns an error if
+// it isn't the expected line
+func (s *Server) Expect(line string) error {
+	l, err := s.ReadLine()
+	if err != nil {
+		return fmt.Errorf("expected %q: %v", line, err)
+	}
+	if l != line {
+		return fmt.Errorf("expected %q, client sent %q", line, l)
+	}
+	return nil
+}
+
+// SkipUntil reads lines from the client until a line that starts with the
+// prefix is received and returns that line
+func (s *Server) SkipUntil(prefix string) (string, error) {
+	for {
+		l, err := s.ReadLine()
+		if err != nil {
+			return "", fmt.Errorf("expected a line starting with %q: %v", prefix, err)
+		}
+		if strings.HasPrefix(l, prefix) {
+			return l, nil
+		}
+	}
+}
+
+// Run runs the script against the client, it stops at the first line that
+// the client sends that doesn't match the script
+func (s *Server) Run(script ...string) error {
+	for i, line := range script {
+		if len(line) < 4 || line[3] != ' ' {
+			return fmt.Errorf("line %d: malformed script line %q", i+1, line)
+		}
+
+		var err error
+		switch line[:3] {
+		case "SRV":
+			err = s.Send(line[4:])
+		case "CLI":
+			err = s.Expect(line[4:])
+		default:
+			return fmt.Errorf("line %d: unknown direction in %q, use SRV or CLI", i+1, line)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection to the client
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
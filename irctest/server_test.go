@@ -0,0 +1,48 @@
+package irctest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/osm/irc"
+	"github.com/osm/irc/irctest"
+)
+
+// TestServer runs a registration and a PING against the client
+func TestServer(t *testing.T) {
+	conn, srv := irctest.Pipe()
+	defer srv.Close()
+
+	c := irc.NewClient(irc.WithConn(conn), irc.WithNick("foo"), irc.WithChannel("#foo"))
+	go c.Connect()
+
+	if err := srv.Run(
+		"CLI CAP LS 302",
+		"CLI USER foo * * :foo",
+		"CLI NICK foo",
+		"SRV :irc.example.net 001 foo :Welcome",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestServerMismatch makes sure that a line that doesn't match the script is
+// reported
+func TestServerMismatch(t *testing.T) {
+	conn, srv := irctest.Pipe()
+	defer srv.Close()
+
+	c := irc.NewClient(irc.WithConn(conn), irc.WithNick("foo"))
+	go c.Connect()
+
+	err := srv.Run("CLI NICK foo")
+	if err == nil || !strings.Contains(err.Error(), `client sent "CAP LS 302"`) {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+
+	if err := srv.Run("FOO bar"); err == nil {
+		t.Errorf("expected an error for an unknown direction")
+	}
+}
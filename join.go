@@ -0,0 +1,125 @@
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// joinFailures contains the reasons for the numerics that the server replies
+// with when a JOIN fails
+var joinFailures = map[string]string{
+	"471": "channel is full",
+	"473": "channel is invite only",
+	"474": "banned from channel",
+	"475": "bad channel key",
+	"477": "registered nick required",
+}
+
+// JoinError is returned by JoinWait when the server refuses to let us join
+// a channel
+type JoinError struct {
+	// Channel is the channel that we tried to join
+	Channel string
+
+	// Code is the numeric that the server replied with, e.g. 474
+	Code string
+
+	// Reason is the text that the server sent along with the numeric
+	Reason string
+}
+
+// Error returns the error as a string
+func (e *JoinError) Error() string {
+	return fmt.Sprintf("unable to join %s: %s (%s)", e.Channel, joinFailures[e.Code], e.Reason)
+}
+
+// Join joins the channel
+func (c *Client) Join(channel string) error {
+	return c.Sendf("JOIN %s", channel)
+}
+
+// JoinKeys joins the channels in the map with their keys, channels that
+// don't have a key have an empty key. The keys are matched to the channels
+// by position, so the channels with keys are listed first.
+func (c *Client) JoinKeys(channels map[string]string) error {
+	if len(channels) == 0 {
+		return nil
+	}
+
+	var keyed, keyless, keys []string
+	for ch, key := range channels {
+		if key != "" {
+			keyed = append(keyed, ch)
+		} else {
+			keyless = append(keyless, ch)
+		}
+	}
+	sort.Strings(keyed)
+	sort.Strings(keyless)
+	for _, ch := range keyed {
+		keys = append(keys, channels[ch])
+	}
+
+	// JOIN <channel>{,<channel>} [<key>{,<key>}]
+	line := "JOIN " + strings.Join(append(keyed, keyless...), ",")
+	if len(keys) > 0 {
+		line += " " + strings.Join(keys, ",")
+	}
+	return c.SendRaw(line)
+}
+
+// JoinWait joins the channel and waits until the server confirms the join, a
+// *JoinError is returned if the server refuses to let us join and an error is
+// returned if the server doesn't reply within the timeout
+func (c *Client) JoinWait(channel string, timeout time.Duration) error {
+	m, err := c.SendAndWait("JOIN "+channel, func(m *Message) bool {
+		c.infoMu.Lock()
+		defer c.infoMu.Unlock()
+
+		switch {
+		case m.Command == "JOIN" && len(m.ParamsArray) > 0:
+			return c.casefold(m.Name) == c.casefold(c.currentNick) &&
+				c.casefold(strings.TrimPrefix(m.ParamsArray[0], prefix)) == c.casefold(channel)
+		case joinFailures[m.Command] != "" && len(m.ParamsArray) > 1:
+			return c.casefold(m.ParamsArray[1]) == c.casefold(channel)
+		}
+		return false
+	}, timeout)
+	if err != nil {
+		return err
+	}
+
+	if m.Command != "JOIN" {
+		return &JoinError{Channel: channel, Code: m.Command, Reason: m.Text()}
+	}
+	return nil
+}
+
+// OnJoinFailed registers a function that is called when the server refuses
+// to let us join a channel, the error contains the channel and the reason
+func (c *Client) OnJoinFailed(fn func(err *JoinError)) {
+	h := func(m *Message) {
+		// <me> <channel> :<reason>
+		if len(m.ParamsArray) < 2 {
+			return
+		}
+		ch := m.ParamsArray[1]
+
+		// 477 is also sent when we try to speak in a channel that
+		// we are in
+		c.infoMu.Lock()
+		joined := c.channelIndex(c.joined, ch) >= 0
+		c.infoMu.Unlock()
+		if joined {
+			return
+		}
+
+		fn(&JoinError{Channel: ch, Code: m.Command, Reason: m.Text()})
+	}
+
+	for code := range joinFailures {
+		c.Handle(code, h)
+	}
+}
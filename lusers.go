@@ -0,0 +1,113 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lusers contains the statistics that the server replies with to LUSERS,
+// counts that the server doesn't send are left as zero
+type Lusers struct {
+	// Users is the number of visible users on the network
+	Users int
+
+	// Invisible is the number of invisible users on the network
+	Invisible int
+
+	// Servers is the number of servers on the network
+	Servers int
+
+	// Operators is the number of operators that are online
+	Operators int
+
+	// Unknown is the number of connections that haven't registered yet
+	Unknown int
+
+	// Channels is the number of channels on the network
+	Channels int
+
+	// LocalClients and LocalServers are the number of clients and
+	// servers that are connected to the server that replied
+	LocalClients int
+	LocalServers int
+
+	// LocalUsers, MaxLocalUsers, GlobalUsers and MaxGlobalUsers are the
+	// current and maximum number of users of the server and the network
+	LocalUsers     int
+	MaxLocalUsers  int
+	GlobalUsers    int
+	MaxGlobalUsers int
+}
+
+// Lusers sends a LUSERS request and returns the statistics that the server
+// replied with. The replies are dispatched to the event handlers of the
+// 251-255, 265 and 266 numerics as usual.
+func (c *Client) Lusers() (*Lusers, error) {
+	// Servers are free to leave out any of the replies, so we'll follow
+	// the request with a PING, the PONG marks the end of the reply
+	token := syncToken("lusers")
+	msgs, err := c.query(func(m *Message) bool {
+		switch m.Command {
+		case "251", "252", "253", "254", "255", "265", "266", "PONG":
+			return true
+		}
+		return false
+	}, func(m *Message) bool {
+		return m.Command == "PONG" && m.Text() == token
+	}, "LUSERS", "PING :"+token)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lusers{}
+	for _, m := range msgs {
+		p := m.ParamsArray
+		switch m.Command {
+		case "251":
+			// <me> :There are <u> users and <i> invisible on <s> servers
+			fmt.Sscanf(m.Text(), "There are %d users and %d invisible on %d servers", &l.Users, &l.Invisible, &l.Servers)
+		case "252":
+			// <me> <ops> :operator(s) online
+			l.Operators = atoiParam(p, 1)
+		case "253":
+			// <me> <connections> :unknown connection(s)
+			l.Unknown = atoiParam(p, 1)
+		case "254":
+			// <me> <channels> :channels formed
+			l.Channels = atoiParam(p, 1)
+		case "255":
+			// <me> :I have <c> clients and <s> servers
+			fmt.Sscanf(m.Text(), "I have %d clients and %d servers", &l.LocalClients, &l.LocalServers)
+		case "265":
+			// <me> [<u> <m>] :Current local users <u>, max <m>
+			l.LocalUsers, l.MaxLocalUsers = userCounts(m, "local")
+		case "266":
+			// <me> [<u> <m>] :Current global users <u>, max <m>
+			l.GlobalUsers, l.MaxGlobalUsers = userCounts(m, "global")
+		}
+	}
+
+	return l, nil
+}
+
+// atoiParam returns the parameter at index i as an integer, zero is returned
+// if it doesn't exist or isn't a number
+func atoiParam(p []string, i int) int {
+	if i >= len(p) {
+		return 0
+	}
+	n, _ := strconv.Atoi(p[i])
+	return n
+}
+
+// userCounts returns the current and maximum number of users of a 265 or 266
+// reply, the counts are taken from the parameters if they are present and
+// from the text otherwise
+func userCounts(m *Message, scope string) (current, max int) {
+	if p := m.ParamsArray; len(p) > 2 && !strings.HasPrefix(p[1], prefix) {
+		return atoiParam(m.ParamsArray, 1), atoiParam(m.ParamsArray, 2)
+	}
+	fmt.Sscanf(m.Text(), "Current "+scope+" users %d, max %d", &current, &max)
+	return current, max
+}
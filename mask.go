@@ -0,0 +1,152 @@
+package irc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Styles of the ban masks that BanMask creates
+const (
+	// BanMaskHost bans everyone from the host, *!*@host
+	BanMaskHost = iota
+
+	// BanMaskUser bans the user at the host, *!user@host
+	BanMaskUser
+
+	// BanMaskNick bans the nick from everywhere, nick!*@*
+	BanMaskNick
+
+	// BanMaskDomain bans everyone from the domain of the host, e.g.
+	// *!*@*.example.com or *!*@192.0.2.*
+	BanMaskDomain
+)
+
+// casefold folds the string according to the CASEMAPPING that the server
+// advertises, rfc1459 is used if the server doesn't advertise anything.
+// The caller must hold infoMu.
+func (c *Client) casefold(s string) string {
+	return casefold(c.isupport["CASEMAPPING"], s)
+}
+
+// casefold folds the string with the given case mapping
+func casefold(mapping, s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case mapping == "ascii":
+			return r
+		case r == '[':
+			return '{'
+		case r == ']':
+			return '}'
+		case r == '\\':
+			return '|'
+		case r == '~' && mapping != "strict-rfc1459":
+			return '^'
+		}
+		return r
+	}, s)
+}
+
+// MatchMask reports whether the hostmask, nick!user@host, matches the mask.
+// The mask may contain the wildcards * and ? which match any number of
+// characters and exactly one character respectively. The comparison is case
+// insensitive according to the rfc1459 case mapping, use Client.MatchMask to
+// use the case mapping of the server instead.
+func MatchMask(mask, hostmask string) bool {
+	return matchMask(casefold("", mask), casefold("", hostmask))
+}
+
+// MatchMask is the package level MatchMask with the CASEMAPPING that the
+// server advertises
+func (c *Client) MatchMask(mask, hostmask string) bool {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return matchMask(c.casefold(mask), c.casefold(hostmask))
+}
+
+// matchMask reports whether s matches the mask, the mask may contain the
+// wildcards * and ? which match any number of characters and exactly one
+// character respectively.
+func matchMask(mask, s string) bool {
+	// Iterative glob matching with backtracking to the last star
+	var mi, si int
+	star, match := -1, 0
+	for si < len(s) {
+		switch {
+		case mi < len(mask) && (mask[mi] == '?' || mask[mi] == s[si]):
+			mi++
+			si++
+		case mi < len(mask) && mask[mi] == '*':
+			star = mi
+			match = si
+			mi++
+		case star >= 0:
+			mi = star + 1
+			match++
+			si = match
+		default:
+			return false
+		}
+	}
+
+	// Trailing stars match the empty string
+	for mi < len(mask) && mask[mi] == '*' {
+		mi++
+	}
+
+	return mi == len(mask)
+}
+
+// BanMask returns a ban mask for the user in the given style, empty parts
+// are replaced with *. An ident that isn't verified, that is prefixed with
+// ~, is matched with or without the ~.
+func BanMask(name, user, host string, style int) string {
+	orStar := func(s string) string {
+		if s == "" {
+			return "*"
+		}
+		return s
+	}
+
+	switch style {
+	case BanMaskUser:
+		if strings.HasPrefix(user, "~") {
+			user = "*" + user[1:]
+		}
+		return "*!" + orStar(user) + "@" + orStar(host)
+	case BanMaskNick:
+		return orStar(name) + "!*@*"
+	case BanMaskDomain:
+		return "*!*@" + orStar(domainMask(host))
+	default:
+		return "*!*@" + orStar(host)
+	}
+}
+
+// domainMask returns a mask that matches the domain of the host, IPv4
+// addresses are masked at /24 and IPv6 addresses at /64. The mask has to
+// match the address as the server shows it, so an IPv6 address that is
+// compressed within the first 64 bits only has its last group masked. Hosts
+// that are too short to have a domain and cloaks are returned as they are.
+func domainMask(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return fmt.Sprintf("%d.%d.%d.*", ip4[0], ip4[1], ip4[2])
+		}
+
+		groups := strings.Split(host, ":")
+		if len(groups) > 4 && indexOf(groups[:4], "") < 0 {
+			return strings.Join(groups[:4], ":") + ":*"
+		}
+		return host[:strings.LastIndex(host, ":")+1] + "*"
+	}
+
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 || strings.Contains(host, "/") {
+		return host
+	}
+	return "*." + strings.Join(labels[1:], ".")
+}
@@ -0,0 +1,72 @@
+package irc
+
+import (
+	"testing"
+)
+
+// TestBanMask tests all ban mask styles with hostnames and addresses
+func TestBanMask(t *testing.T) {
+	tests := []struct {
+		name, user, host string
+		style            int
+		mask             string
+	}{
+		{"foo", "bar", "host.example.com", BanMaskHost, "*!*@host.example.com"},
+		{"foo", "bar", "192.0.2.1", BanMaskHost, "*!*@192.0.2.1"},
+		{"foo", "bar", "", BanMaskHost, "*!*@*"},
+		{"foo", "bar", "host.example.com", BanMaskUser, "*!bar@host.example.com"},
+		{"foo", "~bar", "192.0.2.1", BanMaskUser, "*!*bar@192.0.2.1"},
+		{"foo", "", "", BanMaskUser, "*!*@*"},
+		{"foo", "bar", "host.example.com", BanMaskNick, "foo!*@*"},
+		{"", "bar", "host.example.com", BanMaskNick, "*!*@*"},
+		{"foo", "bar", "host.example.com", BanMaskDomain, "*!*@*.example.com"},
+		{"foo", "bar", "example.com", BanMaskDomain, "*!*@example.com"},
+		{"foo", "bar", "user/foo/bar.baz.qux", BanMaskDomain, "*!*@user/foo/bar.baz.qux"},
+		{"foo", "bar", "192.0.2.1", BanMaskDomain, "*!*@192.0.2.*"},
+		{"foo", "bar", "2001:db8::1", BanMaskDomain, "*!*@2001:db8::*"},
+		{"foo", "bar", "2001:db8:1:2::1", BanMaskDomain, "*!*@2001:db8:1:2:*"},
+		{"foo", "bar", "2001:db8:1:2:3:4:5:6", BanMaskDomain, "*!*@2001:db8:1:2:*"},
+	}
+
+	for _, tt := range tests {
+		if mask := BanMask(tt.name, tt.user, tt.host, tt.style); mask != tt.mask {
+			t.Errorf("BanMask(%q, %q, %q, %d) = %q, expected %q", tt.name, tt.user, tt.host, tt.style, mask, tt.mask)
+		}
+
+		// The user must match the mask
+		nick := tt.name
+		if nick == "" {
+			nick = "foo"
+		}
+		if !matchMask(tt.mask, nick+"!"+tt.user+"@"+tt.host) {
+			t.Errorf("%q doesn't match %s!%s@%s", tt.mask, nick, tt.user, tt.host)
+		}
+	}
+}
+
+// TestMatchMask tests the wildcards and the case insensitive matching
+func TestMatchMask(t *testing.T) {
+	tests := []struct {
+		mask, hostmask string
+		match          bool
+	}{
+		{"*!*@*.example.com", "foo!~bar@host.example.com", true},
+		{"*!*@*.example.com", "foo!~bar@example.com", false},
+		{"*!*@*.EXAMPLE.com", "foo!~bar@Host.Example.COM", true},
+		{"foo!*@*", "FOO!bar@baz", true},
+		{"fo?!*@*", "foo!bar@baz", true},
+		{"fo?!*@*", "fo!bar@baz", false},
+		{"f??!*@*", "foo!bar@baz", true},
+		{"*!b?r@*", "foo!bar@baz", true},
+		{"*", "foo!bar@baz", true},
+		{"foo[a]!*@*", "FOO{A}!bar@baz", true},
+		{"*!*@192.0.2.*", "foo!bar@192.0.2.10", true},
+		{"*!*@192.0.2.*", "foo!bar@192.0.20.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchMask(tt.mask, tt.hostmask); got != tt.match {
+			t.Errorf("MatchMask(%q, %q) = %v, expected %v", tt.mask, tt.hostmask, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package irc
+
+import (
+	"strings"
+)
+
+// member is a member of a channel, prefixes contains the prefix symbols of
+// the member in the order that the server ranks them, e.g. @+. The user and
+// host are empty until we have seen them.
+type member struct {
+	nick     string
+	user     string
+	host     string
+	prefixes string
+}
+
+// prefixModes returns the channel modes that give a prefix and their
+// symbols, ordered from the highest rank to the lowest, as advertised by the
+// PREFIX ISUPPORT token. The caller must hold infoMu.
+func (c *Client) prefixModes() (modes, symbols string) {
+	p, ok := c.isupport["PREFIX"]
+	if !ok {
+		p = "(ov)@+"
+	}
+
+	// (<modes>)<symbols>
+	i := strings.Index(p, ")")
+	if !strings.HasPrefix(p, "(") || i < 0 || len(p[1:i]) != len(p[i+1:]) {
+		return "", ""
+	}
+	return p[1:i], p[i+1:]
+}
+
+// addPrefix adds the symbol to the prefixes in rank order
+func addPrefix(prefixes, symbol, symbols string) string {
+	if strings.Contains(prefixes, symbol) {
+		return prefixes
+	}
+
+	var b strings.Builder
+	for _, s := range symbols {
+		if strings.ContainsRune(prefixes, s) || string(s) == symbol {
+			b.WriteRune(s)
+		}
+	}
+	return b.String()
+}
+
+// updateMembers updates the members of the channels that we are in, the
+// caller must hold infoMu
+func (c *Client) updateMembers(m *Message) {
+	p := m.ParamsArray
+	self := c.casefold(m.Name) == c.casefold(c.currentNick)
+
+	switch m.Command {
+	case "353":
+		// <me> <symbol> <channel> :[prefixes]<nick> [[prefixes]<nick> ...]
+		if len(p) < 3 {
+			return
+		}
+		ch := c.members[c.casefold(p[2])]
+		if ch == nil {
+			return
+		}
+
+		_, symbols := c.prefixModes()
+		for _, n := range strings.Fields(m.Text()) {
+			var prefixes string
+			for len(n) > 0 && strings.IndexByte(symbols, n[0]) >= 0 {
+				prefixes = addPrefix(prefixes, n[:1], symbols)
+				n = n[1:]
+			}
+
+			// The entries are nick!user@host if userhost-in-names
+			// is enabled, otherwise they are just the nick
+			mb := &member{nick: n, prefixes: prefixes}
+			if i := strings.Index(n, hostPrefix); i >= 0 {
+				mb.nick, mb.host = n[:i], n[i+1:]
+			}
+			if i := strings.Index(mb.nick, userPrefix); i >= 0 {
+				mb.nick, mb.user = mb.nick[:i], mb.nick[i+1:]
+			}
+			if mb.nick != "" {
+				ch[c.casefold(mb.nick)] = mb
+			}
+		}
+
+	case "JOIN":
+		if len(p) == 0 {
+			return
+		}
+		key := c.casefold(strings.TrimPrefix(p[0], prefix))
+		if self {
+			c.members[key] = make(map[string]*member)
+		}
+		if ch := c.members[key]; ch != nil {
+			ch[c.casefold(m.Name)] = &member{nick: m.Name, user: m.User, host: m.Host}
+		}
+
+	case "PART", "KICK":
+		// PART <channel>, KICK <channel> <nick>
+		if len(p) == 0 {
+			return
+		}
+		key := c.casefold(strings.TrimPrefix(p[0], prefix))
+		nick := m.Name
+		if m.Command == "KICK" {
+			if len(p) < 2 {
+				return
+			}
+			nick = p[1]
+		}
+
+		if c.casefold(nick) == c.casefold(c.currentNick) {
+			delete(c.members, key)
+		} else if ch := c.members[key]; ch != nil {
+			delete(ch, c.casefold(nick))
+		}
+
+	case "QUIT":
+		for _, ch := range c.members {
+			delete(ch, c.casefold(m.Name))
+		}
+
+	case "NICK":
+		if len(p) == 0 {
+			return
+		}
+		nick := strings.TrimPrefix(p[0], prefix)
+		for _, ch := range c.members {
+			if mb, ok := ch[c.casefold(m.Name)]; ok {
+				delete(ch, c.casefold(m.Name))
+				mb.nick = nick
+				ch[c.casefold(nick)] = mb
+			}
+		}
+
+	case "MODE":
+		// MODE <channel> <modes> [<param> ...]
+		if len(p) < 2 {
+			return
+		}
+		if ch := c.members[c.casefold(p[0])]; ch != nil {
+			c.updateMemberModes(ch, p[1], p[2:])
+		}
+
+	case "RENAME":
+		// RENAME <old> <new> :<reason>
+		if len(p) < 2 {
+			return
+		}
+		old, new := c.casefold(p[0]), c.casefold(strings.TrimPrefix(p[1], prefix))
+		if ch, ok := c.members[old]; ok {
+			delete(c.members, old)
+			c.members[new] = ch
+		}
+	}
+}
+
+// updateMemberModes applies the prefix modes of a channel mode change to the
+// members of the channel, the caller must hold infoMu
+func (c *Client) updateMemberModes(ch map[string]*member, modes string, params []string) {
+	prefixModes, symbols := c.prefixModes()
+
+	// CHANMODES=<always a param>,<always a param>,<param when set>,<never a param>
+	chanModes := strings.Split(c.isupport["CHANMODES"], ",")
+	for len(chanModes) < 4 {
+		chanModes = append(chanModes, "")
+	}
+
+	set := true
+	for _, r := range modes {
+		switch {
+		case r == '+' || r == '-':
+			set = r == '+'
+
+		case strings.ContainsRune(prefixModes, r):
+			if len(params) == 0 {
+				return
+			}
+			nick := strings.TrimPrefix(params[0], prefix)
+			params = params[1:]
+
+			mb, ok := ch[c.casefold(nick)]
+			if !ok {
+				continue
+			}
+			symbol := string(symbols[strings.IndexRune(prefixModes, r)])
+			if set {
+				mb.prefixes = addPrefix(mb.prefixes, symbol, symbols)
+			} else {
+				mb.prefixes = strings.Replace(mb.prefixes, symbol, "", 1)
+			}
+
+		case strings.ContainsRune(chanModes[0], r) || strings.ContainsRune(chanModes[1], r) ||
+			set && strings.ContainsRune(chanModes[2], r):
+			// The mode has a parameter that we don't care about
+			if len(params) > 0 {
+				params = params[1:]
+			}
+		}
+	}
+}
+
+// ChannelMembers returns the members of a channel that we are in, the map
+// contains the nick of each member and its highest prefix, e.g. @ or +, or
+// an empty string if the member doesn't have any prefix
+func (c *Client) ChannelMembers(channel string) map[string]string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	members := make(map[string]string)
+	for _, mb := range c.members[c.casefold(channel)] {
+		var p string
+		if mb.prefixes != "" {
+			p = mb.prefixes[:1]
+		}
+		members[mb.nick] = p
+	}
+	return members
+}
+
+// MemberPrefixes returns all prefixes of the nick in the channel ordered from
+// the highest rank to the lowest, e.g. @+. All prefixes are only known when
+// the multi-prefix capability is enabled, otherwise the server only tells us
+// about the highest prefix of each member.
+func (c *Client) MemberPrefixes(channel, nick string) string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	if mb, ok := c.members[c.casefold(channel)][c.casefold(nick)]; ok {
+		return mb.prefixes
+	}
+	return ""
+}
+
+// UserHost returns the user and host of a nick that shares a channel with
+// us, ok is false if we don't know them. They are learned from JOINs and
+// from NAMES replies when the userhost-in-names capability is enabled.
+func (c *Client) UserHost(nick string) (user, host string, ok bool) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	for _, ch := range c.members {
+		if mb, found := ch[c.casefold(nick)]; found && mb.host != "" {
+			return mb.user, mb.host, true
+		}
+	}
+	return "", "", false
+}
+
+// hasPrefix reports whether the nick has the prefix of the mode, or the
+// prefix of a mode that ranks higher, in the channel
+func (c *Client) hasPrefix(channel, nick string, mode rune) bool {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	mb, ok := c.members[c.casefold(channel)][c.casefold(nick)]
+	if !ok || mb.prefixes == "" {
+		return false
+	}
+
+	modes, symbols := c.prefixModes()
+	i := strings.IndexRune(modes, mode)
+	if i < 0 {
+		return false
+	}
+
+	// Symbols are ordered from the highest rank to the lowest
+	return strings.IndexByte(symbols, mb.prefixes[0]) <= i
+}
+
+// IsOp reports whether the nick is an operator in the channel, members with
+// a higher prefix such as owner are operators as well
+func (c *Client) IsOp(channel, nick string) bool {
+	return c.hasPrefix(channel, nick, 'o')
+}
+
+// IsVoice reports whether the nick has voice in the channel, members with a
+// higher prefix such as operators have voice as well
+func (c *Client) IsVoice(channel, nick string) bool {
+	return c.hasPrefix(channel, nick, 'v')
+}
@@ -3,6 +3,7 @@ package irc
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Message represents the RFC1459 definition of an IRC message
@@ -20,6 +21,10 @@ type Message struct {
 	// ParamsArray is equal to Params, but are splitted on space for easier manipulation
 	ParamsArray []string
 
+	// Prefix contains the raw prefix of the message without the leading
+	// colon, it is empty if the message doesn't have a prefix
+	Prefix string
+
 	// Name is an optional field, if it contains data it holds either the server name or a nick
 	Name string
 
@@ -28,10 +33,21 @@ type Message struct {
 
 	// Host is also an optional parameter that contains the host if the message originates from a client
 	Host string
+
+	// Tags contains the IRCv3 message tags, it is nil if the message doesn't have any tags
+	Tags map[string]string
+
+	// ID contains the msgid tag which uniquely identifies the message
+	ID string
+
+	// ReceivedAt is the time when the message was received, the time of
+	// the server-time tag is used instead if the message has one
+	ReceivedAt time.Time
 }
 
 // Constants to improve code readability
 const (
+	tagPrefix  string = "@"
 	prefix     string = ":"
 	userPrefix string = "!"
 	hostPrefix string = "@"
@@ -52,25 +68,37 @@ func parse(m string) (*Message, error) {
 		return nil, nil
 	}
 
+	// Check if the message has tags, if so, parse them
+	// The tags doesn't count towards the maximum size of the message
+	size := len(m)
+	if len(p) > 0 && strings.Index(p[0], tagPrefix) == 0 {
+		r.Tags = parseTags(p[0][1:])
+		r.ID = r.Tags["msgid"]
+		size -= len(p[0]) + 1
+		p = p[1:]
+	}
+
 	// The message must contain at least two parts
-	if len(p) < 2 || int64(len(m)) > maxSize {
+	if len(p) < 2 || int64(size) > maxSize {
 		return nil, fmt.Errorf("malformed message '%s'", m)
 	}
 
 	// Check if the message is prefixed, if so, parse the prefix
 	if strings.Index(p[0], prefix) == 0 {
-		// Extract index of user and host prefixes
-		ui := strings.Index(p[0], userPrefix)
-		hi := strings.Index(p[0], hostPrefix)
-
-		// First case means that there is an extended prefix
-		// Otherwise it's just a server message without any additional client information
-		if ui != hi {
-			r.Name = p[0][1:ui]
-			r.User = p[0][ui+1 : hi]
-			r.Host = p[0][hi+1:]
-		} else {
-			r.Name = p[0][1:]
+		r.Prefix = p[0][1:]
+		r.Name = r.Prefix
+
+		// The host is everything after the host prefix and the user is
+		// between the user and host prefixes, either of them may be
+		// missing. Without them it's just a server message without any
+		// additional client information.
+		if hi := strings.Index(r.Name, hostPrefix); hi >= 0 {
+			r.Host = r.Name[hi+1:]
+			r.Name = r.Name[:hi]
+		}
+		if ui := strings.Index(r.Name, userPrefix); ui >= 0 {
+			r.User = r.Name[ui+1:]
+			r.Name = r.Name[:ui]
 		}
 
 		// We are done with this data, so let's discard it to make parsing easier
@@ -88,3 +116,46 @@ func parse(m string) (*Message, error) {
 	// Return the message
 	return r, nil
 }
+
+// FromServer returns true if the message originates from a server rather
+// than from a user, that is when the prefix doesn't contain a user or a host.
+// Messages without a prefix originate from the server that we are connected
+// to.
+func (m *Message) FromServer() bool {
+	return !strings.ContainsAny(m.Prefix, userPrefix+hostPrefix)
+}
+
+// Text returns the trailing parameter of the message, that is everything
+// after the first colon prefixed parameter. For a PRIVMSG this is the text
+// of the message. Servers may leave out the colon when the trailing
+// parameter is a single word, the last parameter is returned then.
+func (m *Message) Text() string {
+	if strings.Index(m.Params, prefix) == 0 {
+		return m.Params[1:]
+	}
+
+	if i := strings.Index(m.Params, " "+prefix); i >= 0 {
+		return m.Params[i+2:]
+	}
+
+	if len(m.ParamsArray) > 0 {
+		return m.ParamsArray[len(m.ParamsArray)-1]
+	}
+	return ""
+}
+
+// replaceInvalidUTF8 replaces all invalid UTF-8 sequences in the parsed
+// fields of the message with the unicode replacement character, Raw is left
+// untouched.
+func (m *Message) replaceInvalidUTF8() {
+	fix := func(s string) string { return strings.ToValidUTF8(s, "\uFFFD") }
+
+	m.Command = fix(m.Command)
+	m.Params = fix(m.Params)
+	m.Name = fix(m.Name)
+	m.User = fix(m.User)
+	m.Host = fix(m.Host)
+	for i := range m.ParamsArray {
+		m.ParamsArray[i] = fix(m.ParamsArray[i])
+	}
+}
@@ -22,6 +22,7 @@ var messageTests = []messageTest{
 			Command:     "JOIN",
 			Params:      ":#foo",
 			ParamsArray: []string{":#foo"},
+			Prefix:      "foo!~bar@127.0.0.1",
 			Name:        "foo",
 			User:        "~bar",
 			Host:        "127.0.0.1",
@@ -34,9 +35,22 @@ var messageTests = []messageTest{
 			Command:     "372",
 			Params:      "foo :- * foo",
 			ParamsArray: []string{"foo", ":-", "*", "foo"},
+			Prefix:      "irc.foo.com",
 			Name:        "irc.foo.com",
 		},
 	},
+	{
+		name: "host without user",
+		raw:  ":foo@127.0.0.1 MODE foo :+i\r\n",
+		msg: &Message{
+			Command:     "MODE",
+			Params:      "foo :+i",
+			ParamsArray: []string{"foo", ":+i"},
+			Prefix:      "foo@127.0.0.1",
+			Name:        "foo",
+			Host:        "127.0.0.1",
+		},
+	},
 	{
 		name: "ping",
 		raw:  "PING :irc.foo.com\r\n",
@@ -46,6 +60,38 @@ var messageTests = []messageTest{
 			ParamsArray: []string{":irc.foo.com"},
 		},
 	},
+	{
+		name: "tags",
+		raw:  `@msgid=abc;time=2026-10-17T12:00:00.000Z;+draft/reply=a\\sb\:c :foo!~bar@127.0.0.1 PRIVMSG #foo :hi` + "\r\n",
+		msg: &Message{
+			Command:     "PRIVMSG",
+			Params:      "#foo :hi",
+			ParamsArray: []string{"#foo", ":hi"},
+			Prefix:      "foo!~bar@127.0.0.1",
+			Name:        "foo",
+			User:        "~bar",
+			Host:        "127.0.0.1",
+			Tags: map[string]string{
+				"msgid":        "abc",
+				"time":         "2026-10-17T12:00:00.000Z",
+				"+draft/reply": `a\sb;c`,
+			},
+			ID: "abc",
+		},
+	},
+	{
+		name: "trailing without colon",
+		raw:  ":foo!~bar@127.0.0.1 PRIVMSG #c word\r\n",
+		msg: &Message{
+			Command:     "PRIVMSG",
+			Params:      "#c word",
+			ParamsArray: []string{"#c", "word"},
+			Prefix:      "foo!~bar@127.0.0.1",
+			Name:        "foo",
+			User:        "~bar",
+			Host:        "127.0.0.1",
+		},
+	},
 	{
 		name: "malformed",
 		raw:  "foo:\r\n",
@@ -83,3 +129,45 @@ func TestMessages(t *testing.T) {
 		})
 	}
 }
+
+// TestFromServer tests that server messages are told apart from user messages
+func TestFromServer(t *testing.T) {
+	tests := map[string]bool{
+		":irc.foo.com 372 foo :- motd\r\n":         true,
+		"PING :irc.foo.com\r\n":                    true,
+		":foo!~bar@127.0.0.1 PRIVMSG #foo :hi\r\n": false,
+		":foo@127.0.0.1 MODE foo :+i\r\n":          false,
+	}
+
+	for raw, want := range tests {
+		m, err := parse(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if m.FromServer() != want {
+			t.Errorf("%q: FromServer() = %v, want %v", raw, !want, want)
+		}
+	}
+}
+
+// TestText tests that the trailing parameter is found with and without the
+// colon
+func TestText(t *testing.T) {
+	tests := map[string]string{
+		":foo!~bar@127.0.0.1 PRIVMSG #c :hello there\r\n": "hello there",
+		":foo!~bar@127.0.0.1 PRIVMSG #c word\r\n":         "word",
+		":irc.foo.com CAP * LS :\r\n":                     "",
+		"PING :irc.foo.com\r\n":                           "irc.foo.com",
+		":irc.foo.com PONG irc.foo.com token\r\n":         "token",
+	}
+
+	for raw, want := range tests {
+		m, err := parse(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		if got := m.Text(); got != want {
+			t.Errorf("%q: Text() = %q, want %q", raw, got, want)
+		}
+	}
+}
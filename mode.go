@@ -0,0 +1,166 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ban is an entry in the ban list of a channel
+type Ban struct {
+	Channel string
+	Mask    string
+	SetBy   string
+	SetAt   time.Time
+}
+
+// combineModes combines mode strings such as +i, +B and -w into a single
+// mode string, +iB-w
+func combineModes(modes []string) string {
+	var b strings.Builder
+	var current rune
+	for _, m := range modes {
+		// Modes without a sign are added
+		sign := '+'
+		for _, r := range m {
+			if r == '+' || r == '-' {
+				sign = r
+				continue
+			}
+
+			if sign != current {
+				b.WriteRune(sign)
+				current = sign
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// QueryMode sends a MODE command without any mode arguments, it can be used
+// to query the modes of a channel or user or to list channel modes such as
+// bans with QueryMode("#channel", "+b"). The ban list replies are collected
+// and passed to the functions registered with OnBanList.
+func (c *Client) QueryMode(target string, modes ...string) error {
+	if len(modes) == 0 {
+		return c.Sendf("MODE %s", target)
+	}
+	return c.Sendf("MODE %s %s", target, strings.Join(modes, " "))
+}
+
+// OnBanList registers a function that is called with the complete ban list of
+// a channel when the server has sent it
+func (c *Client) OnBanList(fn func(channel string, bans []Ban)) {
+	c.infoMu.Lock()
+	c.banListFns = append(c.banListFns, fn)
+	c.infoMu.Unlock()
+}
+
+// parseBan parses a RPL_BANLIST (367) message
+func parseBan(m *Message) (Ban, bool) {
+	// <me> <channel> <mask> [<who> <time>]
+	if len(m.ParamsArray) < 3 {
+		return Ban{}, false
+	}
+
+	b := Ban{
+		Channel: m.ParamsArray[1],
+		Mask:    m.ParamsArray[2],
+	}
+	if len(m.ParamsArray) >= 5 {
+		b.SetBy = m.ParamsArray[3]
+		if ts, err := strconv.ParseInt(m.ParamsArray[4], 10, 64); err == nil {
+			b.SetAt = time.Unix(ts, 0)
+		}
+	}
+
+	return b, true
+}
+
+// BanList requests the ban list of the channel and returns it once the server
+// has sent all entries. An error is returned if we aren't allowed to view the
+// ban list or if the server doesn't reply in time.
+func (c *Client) BanList(channel string) ([]Ban, error) {
+	w := c.wait(func(m *Message) bool {
+		switch m.Command {
+		case "367", "368", "403", "442", "482":
+			return len(m.ParamsArray) > 1 && strings.EqualFold(m.ParamsArray[1], channel)
+		}
+		return false
+	})
+	defer c.stopWait(w)
+
+	if err := c.QueryMode(channel, "+b"); err != nil {
+		return nil, err
+	}
+
+	var bans []Ban
+	timeout := c.clock.After(replyTimeout)
+	for {
+		select {
+		case m := <-w.ch:
+			switch m.Command {
+			case "367":
+				if b, ok := parseBan(m); ok {
+					bans = append(bans, b)
+				}
+			case "368":
+				return bans, nil
+			default:
+				return nil, fmt.Errorf("unable to get ban list for %s: %s", channel, m.Text())
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for ban list for %s", channel)
+		}
+	}
+}
+
+// SetBotMode flags us as a bot with the user mode that the server advertises
+// in the BOT ISUPPORT token, nothing is sent and an error is returned if the
+// server doesn't advertise a bot mode.
+func (c *Client) SetBotMode() error {
+	c.infoMu.Lock()
+	mode := c.isupport["BOT"]
+	nick := c.currentNick
+	c.infoMu.Unlock()
+
+	if mode == "" {
+		return fmt.Errorf("the server doesn't advertise a bot mode")
+	}
+
+	return c.Sendf("MODE %s +%s", nick, mode)
+}
+
+// SetChannelKey sets the key that is required to join the channel
+func (c *Client) SetChannelKey(channel, key string) error {
+	return c.Sendf("MODE %s +k %s", channel, key)
+}
+
+// RemoveChannelKey removes the key of the channel, many servers require the
+// current key to be given when it is removed
+func (c *Client) RemoveChannelKey(channel, key string) error {
+	if key == "" {
+		key = "*"
+	}
+	return c.Sendf("MODE %s -k %s", channel, key)
+}
+
+// SetLimit limits the number of users in the channel, the limit is removed
+// if n is zero or less
+func (c *Client) SetLimit(channel string, n int) error {
+	if n <= 0 {
+		return c.Sendf("MODE %s -l", channel)
+	}
+	return c.Sendf("MODE %s +l %d", channel, n)
+}
+
+// SetModerated turns moderation of the channel on or off, only users with
+// voice or higher can speak in a moderated channel
+func (c *Client) SetModerated(channel string, on bool) error {
+	if on {
+		return c.Sendf("MODE %s +m", channel)
+	}
+	return c.Sendf("MODE %s -m", channel)
+}
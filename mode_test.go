@@ -0,0 +1,72 @@
+package irc
+
+import (
+	"testing"
+)
+
+// TestCombineModes tests that mode strings are combined correctly
+func TestCombineModes(t *testing.T) {
+	tests := []struct {
+		modes    []string
+		expected string
+	}{
+		{[]string{"+iB"}, "+iB"},
+		{[]string{"+i", "+B"}, "+iB"},
+		{[]string{"+i", "-w", "+B"}, "+i-w+B"},
+		{[]string{"i", "B"}, "+iB"},
+		{[]string{"+i-w", "-x"}, "+i-wx"},
+	}
+
+	for _, mt := range tests {
+		if m := combineModes(mt.modes); m != mt.expected {
+			t.Errorf("%v: got %s, expected %s", mt.modes, m, mt.expected)
+		}
+	}
+}
+
+// TestChannelModeHelpers tests the MODE lines of the channel mode helpers
+func TestChannelModeHelpers(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	tests := []struct {
+		fn   func() error
+		line string
+	}{
+		{func() error { return c.SetChannelKey("#foo", "secret") }, "MODE #foo +k secret"},
+		{func() error { return c.RemoveChannelKey("#foo", "secret") }, "MODE #foo -k secret"},
+		{func() error { return c.RemoveChannelKey("#foo", "") }, "MODE #foo -k *"},
+		{func() error { return c.SetLimit("#foo", 10) }, "MODE #foo +l 10"},
+		{func() error { return c.SetLimit("#foo", 0) }, "MODE #foo -l"},
+		{func() error { return c.SetModerated("#foo", true) }, "MODE #foo +m"},
+		{func() error { return c.SetModerated("#foo", false) }, "MODE #foo -m"},
+	}
+
+	for _, mt := range tests {
+		go mt.fn()
+		if l, _ := tr.ReadLine(); l != mt.line {
+			t.Errorf("got %s, expected %s", l, mt.line)
+		}
+	}
+}
+
+// TestSetBotMode tests that the bot mode is taken from the BOT ISUPPORT token
+func TestSetBotMode(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	if err := c.SetBotMode(); err == nil {
+		t.Errorf("expected an error without a BOT token")
+	}
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 005 foo BOT=B :are supported by this server",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+
+	go c.SetBotMode()
+	runScript(t, conn, tr, []string{
+		"CLI MODE foo +B",
+	})
+}
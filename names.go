@@ -0,0 +1,76 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// namesEntry is a cached NAMES reply
+type namesEntry struct {
+	names []string
+	at    time.Time
+}
+
+// Names returns the members of the channel as they are listed in a NAMES
+// reply, each nick is prefixed by its prefixes, e.g. @foo. The members are
+// taken from the channel state if we are in the channel, otherwise from the
+// cache if a TTL has been set with WithNamesCacheTTL and the cached reply is
+// fresh, or else the server is asked.
+func (c *Client) Names(channel string) ([]string, error) {
+	c.infoMu.Lock()
+	key := c.casefold(channel)
+	if ch, ok := c.members[key]; ok {
+		names := make([]string, 0, len(ch))
+		for _, mb := range ch {
+			names = append(names, mb.prefixes+mb.nick)
+		}
+		c.infoMu.Unlock()
+		sort.Strings(names)
+		return names, nil
+	}
+	if e, ok := c.namesCache[key]; ok && c.clock.Now().Sub(e.at) < c.namesCacheTTL {
+		names := append([]string(nil), e.names...)
+		c.infoMu.Unlock()
+		return names, nil
+	}
+	c.infoMu.Unlock()
+
+	// <me> <symbol> <channel> :[prefixes]<nick> ... and <me> <channel> :End
+	// of /NAMES list
+	isChannel := func(m *Message, i int) bool {
+		c.infoMu.Lock()
+		defer c.infoMu.Unlock()
+		return len(m.ParamsArray) > i && c.casefold(m.ParamsArray[i]) == key
+	}
+	msgs, err := c.query(func(m *Message) bool {
+		return m.Command == "353" && isChannel(m, 2) || m.Command == "366" && isChannel(m, 1)
+	}, func(m *Message) bool {
+		return m.Command == "366"
+	}, "NAMES "+channel)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, m := range msgs {
+		if m.Command != "353" {
+			continue
+		}
+		for _, n := range strings.Fields(m.Text()) {
+			// Remove the user and host if userhost-in-names is used
+			if i := strings.Index(n, userPrefix); i >= 0 {
+				n = n[:i]
+			}
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	if c.namesCacheTTL > 0 {
+		c.infoMu.Lock()
+		c.namesCache[key] = namesEntry{names, c.clock.Now()}
+		c.infoMu.Unlock()
+	}
+	return append([]string(nil), names...), nil
+}
@@ -0,0 +1,61 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNames tests that the members are taken from the channel state, the
+// cache or the server
+func TestNames(t *testing.T) {
+	clock := newFakeClock()
+	c, conn, tr := newTestClient(WithClock(clock), WithNamesCacheTTL(time.Minute))
+	defer conn.Server.Close()
+
+	names := func(channel string) string {
+		names, err := c.Names(channel)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(names, " ")
+	}
+	query := func(channel string, script []string) string {
+		ch := make(chan string)
+		go func() { ch <- names(channel) }()
+		runScript(t, conn, tr, script)
+		return <-ch
+	}
+	reply := []string{
+		"CLI NAMES #bar",
+		"SRV :irc.example.net 353 foo = #bar :@+qux!~qux@127.0.0.1 quux!~quux@127.0.0.1",
+		"SRV :irc.example.net 366 foo #bar :End of /NAMES list.",
+	}
+
+	// The members of a channel that we are in are known
+	runScript(t, conn, tr, []string{
+		"SRV :foo!~foo@127.0.0.1 JOIN #foo",
+		"SRV :irc.example.net 353 foo = #foo :foo @baz",
+		"SRV :irc.example.net 366 foo #foo :End of /NAMES list.",
+		"SRV PING :sync",
+		"CLI PONG :sync",
+	})
+	if n := names("#FOO"); n != "@baz foo" {
+		t.Errorf("unexpected names %q", n)
+	}
+
+	// Other channels are requested and cached
+	if n := query("#bar", reply); n != "@+qux quux" {
+		t.Errorf("unexpected names %q", n)
+	}
+	clock.Advance(30 * time.Second)
+	if n := names("#bar"); n != "@+qux quux" {
+		t.Errorf("unexpected cached names %q", n)
+	}
+
+	// The cache expires
+	clock.Advance(30 * time.Second)
+	if n := query("#bar", reply); n != "@+qux quux" {
+		t.Errorf("unexpected names %q", n)
+	}
+}
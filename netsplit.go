@@ -0,0 +1,163 @@
+package irc
+
+import (
+	"strings"
+	"time"
+)
+
+// netsplitExpiry is how long we remember the nicks that were lost in a
+// netsplit, a JOIN from such a nick is part of a netjoin
+const netsplitExpiry = time.Hour
+
+// netsplitBatch collects the nicks that are lost or return in a netsplit
+// until the window has passed
+type netsplitBatch struct {
+	servers string
+	nicks   []string
+}
+
+// splitNick is a nick that was lost in a netsplit
+type splitNick struct {
+	servers string
+	at      time.Time
+}
+
+// parseNetsplit returns the servers of a QUIT reason that looks like a
+// netsplit, that is the names of the two servers that lost each other
+func parseNetsplit(reason string) (string, bool) {
+	p := strings.Split(reason, " ")
+	if len(p) != 2 || p[0] == p[1] {
+		return "", false
+	}
+
+	for _, s := range p {
+		if !strings.Contains(s, ".") || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") ||
+			strings.ContainsAny(s, "/:!@") {
+			return "", false
+		}
+	}
+	return reason, true
+}
+
+// netsplitMiddleware holds the QUITs and JOINs of a netsplit and a netjoin
+// back and dispatches them as a single NETSPLIT or NETJOIN message instead
+func (c *Client) netsplitMiddleware(next Handler) Handler {
+	return func(m *Message) {
+		if c.netsplitWindow <= 0 {
+			next(m)
+			return
+		}
+
+		switch m.Command {
+		case "QUIT":
+			if servers, ok := parseNetsplit(m.Text()); ok {
+				c.addNetsplit(servers, m.Name)
+				return
+			}
+
+		case "JOIN":
+			if c.addNetjoin(m.Name) {
+				return
+			}
+		}
+
+		next(m)
+	}
+}
+
+// addNetsplit adds the nick to the netsplit between the servers
+func (c *Client) addNetsplit(servers, nick string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	// Forget about the nicks that haven't returned for a long time
+	now := c.clock.Now()
+	for k, s := range c.splitNicks {
+		if now.Sub(s.at) > netsplitExpiry {
+			delete(c.splitNicks, k)
+		}
+	}
+	c.splitNicks[c.casefold(nick)] = splitNick{servers, now}
+
+	c.addNetsplitBatch(c.netsplits, "NETSPLIT", servers, nick)
+}
+
+// addNetjoin adds the nick to a netjoin if it was lost in a netsplit, it
+// returns false if the nick isn't part of a netjoin
+func (c *Client) addNetjoin(nick string) bool {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	key := c.casefold(nick)
+	if servers, ok := c.joiningNicks[key]; ok {
+		// The nick has already returned, this is the JOIN of
+		// another channel
+		return c.netjoins[servers] != nil
+	}
+
+	s, ok := c.splitNicks[key]
+	if !ok || c.clock.Now().Sub(s.at) > netsplitExpiry {
+		return false
+	}
+	delete(c.splitNicks, key)
+	c.joiningNicks[key] = s.servers
+
+	c.addNetsplitBatch(c.netjoins, "NETJOIN", s.servers, nick)
+	return true
+}
+
+// addNetsplitBatch adds the nick to the batch of the servers, the batch is
+// dispatched as a message with the command once the window has passed. The
+// caller must hold infoMu.
+func (c *Client) addNetsplitBatch(batches map[string]*netsplitBatch, command, servers, nick string) {
+	if b, ok := batches[servers]; ok {
+		b.nicks = append(b.nicks, nick)
+		return
+	}
+	batches[servers] = &netsplitBatch{servers: servers, nicks: []string{nick}}
+
+	gen := c.connGen
+	go func() {
+		select {
+		case <-c.clock.After(c.netsplitWindow):
+		case <-c.done:
+			return
+		}
+
+		c.infoMu.Lock()
+		b := batches[servers]
+		delete(batches, servers)
+		if command == "NETJOIN" {
+			for _, n := range b.nicks {
+				delete(c.joiningNicks, c.casefold(n))
+			}
+		}
+		current := gen == c.connGen
+		c.infoMu.Unlock()
+
+		// The batch belongs to a connection that is gone
+		if !current {
+			return
+		}
+
+		// NETSPLIT <server> <server> :<nick> [<nick> ...]
+		params := servers + " :" + strings.Join(b.nicks, " ")
+		c.dispatch(&Message{
+			Command:     command,
+			Params:      params,
+			ParamsArray: strings.Fields(params),
+			ReceivedAt:  c.clock.Now(),
+		})
+	}()
+}
+
+// handleNetsplit reclaims our nick if it was lost in a netsplit, in the same
+// way as if it had quit
+func (c *Client) handleNetsplit(m *Message) {
+	for _, nick := range strings.Fields(m.Text()) {
+		if nick == c.nick {
+			c.send("NICK " + c.nick)
+			return
+		}
+	}
+}
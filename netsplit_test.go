@@ -0,0 +1,25 @@
+package irc
+
+import (
+	"testing"
+)
+
+// TestParseNetsplit tests the detection of netsplit QUIT reasons
+func TestParseNetsplit(t *testing.T) {
+	tests := map[string]bool{
+		"hub.example.net leaf.example.net": true,
+		"*.net *.split":                    true,
+		"hub.example.net hub.example.net":  false,
+		"gone to lunch":                    false,
+		"Quit: bye.bye now.then":           false,
+		"http://example.com/ example.net":  false,
+		"example.net":                      false,
+		".example.net leaf.example.net":    false,
+	}
+
+	for reason, want := range tests {
+		if _, ok := parseNetsplit(reason); ok != want {
+			t.Errorf("parseNetsplit(%q) = %v, expected %v", reason, ok, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// identifyTimeout is the time we wait for the services to confirm that we are
+// identified before we give up on waiting
+const identifyTimeout = 10 * time.Second
+
+// defaultRegisterCommand is the command that is sent to NickServ to register
+// an account unless another one is set with WithNickServRegisterCommand
+const defaultRegisterCommand = "REGISTER {password} {email}"
+
+// nickServNick returns the nick of the NickServ service
+func (c *Client) nickServNick() string {
+	if c.nickServ != "" {
+		return c.nickServ
+	}
+	return "NickServ"
+}
+
+// identify sends our password to NickServ, the password is redacted from the
+// debug log
+func (c *Client) identify() error {
+	return c.send(fmt.Sprintf("PRIVMSG %s :IDENTIFY %s", c.nickServNick(), c.nickServPassword), c.nickServPassword)
+}
+
+// Ghost asks NickServ to disconnect the user that is using the nick, the
+// password is redacted from the debug log
+func (c *Client) Ghost(nick, password string) error {
+	return c.send(fmt.Sprintf("PRIVMSG %s :GHOST %s %s", c.nickServNick(), nick, password), password)
+}
+
+// Regain asks NickServ to disconnect the user that is using the nick and to
+// change our nick to it, the password is redacted from the debug log
+func (c *Client) Regain(nick, password string) error {
+	return c.send(fmt.Sprintf("PRIVMSG %s :REGAIN %s %s", c.nickServNick(), nick, password), password)
+}
+
+// RegisterAccount registers our current nick with NickServ and waits for the
+// reply. The command can be changed with WithNickServRegisterCommand for
+// networks that use another syntax. Since the replies of the services are
+// meant for humans the result is determined by looking for common phrases,
+// an error containing the reply is returned if the registration failed.
+func (c *Client) RegisterAccount(password, email string) error {
+	cmd := c.nickServRegister
+	if cmd == "" {
+		cmd = defaultRegisterCommand
+	}
+	cmd = strings.NewReplacer("{password}", password, "{email}", email).Replace(cmd)
+
+	service := c.nickServNick()
+	w := c.wait(func(m *Message) bool {
+		return m.Command == "NOTICE" && strings.EqualFold(m.Name, service)
+	})
+	defer c.stopWait(w)
+
+	if err := c.send(fmt.Sprintf("PRIVMSG %s :%s", service, cmd), password); err != nil {
+		return err
+	}
+
+	timeout := c.clock.After(identifyTimeout)
+	for {
+		select {
+		case m := <-w.ch:
+			// A successful registration might be followed by
+			// something like "you must confirm your email", so
+			// success is looked for before the generic failures
+			text := strings.ToLower(m.Text())
+			switch {
+			case strings.Contains(text, "already registered"):
+				return fmt.Errorf("unable to register: %s", m.Text())
+			case strings.Contains(text, "registered"):
+				return nil
+			case strings.Contains(text, "invalid"),
+				strings.Contains(text, "not a valid"),
+				strings.Contains(text, "must"),
+				strings.Contains(text, "cannot"),
+				strings.Contains(text, "denied"),
+				strings.Contains(text, "disabled"):
+				return fmt.Errorf("unable to register: %s", m.Text())
+			}
+		case <-timeout:
+			return fmt.Errorf("timeout waiting for %s to reply", service)
+		}
+	}
+}
+
+// identifyAndWait identifies with NickServ and waits until the server tells
+// us that we are logged in (900) or that it failed (902, 904).
+func (c *Client) identifyAndWait() error {
+	w := c.wait(func(m *Message) bool {
+		return m.Command == "900" || m.Command == "902" || m.Command == "904"
+	})
+	defer c.stopWait(w)
+
+	if err := c.identify(); err != nil {
+		return err
+	}
+
+	select {
+	case m := <-w.ch:
+		if m.Command != "900" {
+			return fmt.Errorf("unable to identify: %s", m.Text())
+		}
+		return nil
+	case <-c.clock.After(identifyTimeout):
+		return fmt.Errorf("timeout waiting for NickServ to identify us")
+	}
+}
+
+// handleNeedRegisteredNick handles 477, which is sent by the server when we
+// try to join or speak in a channel that requires a registered nick. If we
+// have a NickServ password we'll identify and try to join the channel again,
+// this is only done once per channel and connection.
+func (c *Client) handleNeedRegisteredNick(m *Message) {
+	// <me> <channel> :<reason>
+	if len(m.ParamsArray) < 2 {
+		return
+	}
+	ch := m.ParamsArray[1]
+
+	// 477 is also sent when we try to speak in a channel that we are in,
+	// we can only retry failed joins.
+	c.infoMu.Lock()
+	key := c.casefold(ch)
+	retry := c.nickServPassword != "" && c.channelIndex(c.joined, ch) < 0 && !c.identifyRetries[key]
+	if retry {
+		c.identifyRetries[key] = true
+	}
+	c.infoMu.Unlock()
+
+	if !retry {
+		c.log("%s: %s", ch, m.Text())
+		return
+	}
+
+	if err := c.identifyAndWait(); err != nil {
+		c.log("%s: %s", ch, err.Error())
+	}
+
+	c.send("JOIN " + ch)
+}
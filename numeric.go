@@ -0,0 +1,22 @@
+package irc
+
+// numericCodes maps the names of the numeric replies to their codes
+var numericCodes = make(map[string]string, len(numericNames))
+
+func init() {
+	for code, name := range numericNames {
+		numericCodes[name] = code
+	}
+}
+
+// NumericName returns the RFC name of a numeric reply, e.g. RPL_WELCOME for
+// 001. An empty string is returned if the numeric is unknown.
+func NumericName(code string) string {
+	return numericNames[code]
+}
+
+// NumericCode returns the numeric reply for a RFC name, e.g. 001 for
+// RPL_WELCOME. An empty string is returned if the name is unknown.
+func NumericCode(name string) string {
+	return numericCodes[name]
+}
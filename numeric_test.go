@@ -0,0 +1,35 @@
+package irc
+
+import (
+	"testing"
+)
+
+// TestNumericNames tests the lookups in both directions and that every name
+// leads back to its numeric
+func TestNumericNames(t *testing.T) {
+	tests := []struct {
+		code, name string
+	}{
+		{"001", "RPL_WELCOME"},
+		{"433", "ERR_NICKNAMEINUSE"},
+		{"999", ""},
+	}
+
+	for _, nt := range tests {
+		if name := NumericName(nt.code); name != nt.name {
+			t.Errorf("NumericName(%s) = %q, want %q", nt.code, name, nt.name)
+		}
+		if nt.name != "" && NumericCode(nt.name) != nt.code {
+			t.Errorf("NumericCode(%s) = %q, want %q", nt.name, NumericCode(nt.name), nt.code)
+		}
+	}
+	if code := NumericCode("RPL_UNKNOWN"); code != "" {
+		t.Errorf("NumericCode(RPL_UNKNOWN) = %q, want an empty string", code)
+	}
+
+	for code := range numericNames {
+		if c := NumericCode(NumericName(code)); c != code {
+			t.Errorf("%s: round trip gave %s", code, c)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package irc
 
 import (
+	"crypto/tls"
 	"log"
 	"net"
+	"time"
+
+	"golang.org/x/text/encoding"
 )
 
 // Option should be implemented by all client options
@@ -15,6 +19,56 @@ func WithAddr(addr string) Option {
 	}
 }
 
+// WithAutoAway marks the client as away with the message when the user hasn't sent anything for the given
+// duration, the client is marked as back when the user sends the next line. The lines that the client sends
+// on its own, such as PONGs and nick reclaims, don't count.
+func WithAutoAway(after time.Duration, message string) Option {
+	return func(c *Client) {
+		c.autoAwayAfter = after
+		c.autoAwayMessage = message
+	}
+}
+
+// WithAutoReclaim makes the client try to reclaim its nick at the given interval after connecting until it
+// succeeds, the interval is raised to at least 5 seconds to avoid flooding the server
+func WithAutoReclaim(interval time.Duration) Option {
+	return func(c *Client) {
+		if interval < minAutoReclaim {
+			interval = minAutoReclaim
+		}
+		c.autoReclaim = interval
+	}
+}
+
+// WithAutoRejoin makes the client join a channel again after the given delay when it is kicked from it,
+// the client gives up after the number of consecutive kicks that is set with WithAutoRejoinLimit
+func WithAutoRejoin(enabled bool, delay time.Duration) Option {
+	return func(c *Client) {
+		c.autoRejoin = enabled
+		c.autoRejoinDelay = delay
+	}
+}
+
+// WithAutoRejoinLimit sets how many times in a row the client rejoins a channel that it is kicked from
+// before it gives up, kicks that are more than five minutes apart aren't counted as in a row. Defaults to 3.
+func WithAutoRejoinLimit(limit int) Option {
+	return func(c *Client) { c.autoRejoinLimit = limit }
+}
+
+// WithBufferedWrites buffers the lines that are sent to the server and writes them together, the
+// buffer is flushed when the interval has passed since the first buffered line or when Flush is called.
+// By default each line is written as soon as it is sent.
+func WithBufferedWrites(interval time.Duration) Option {
+	return func(c *Client) { c.flushInterval = interval }
+}
+
+// WithCapabilities sets the IRCv3 capabilities that the client requests from the server, this can be
+// called multiple times. Capabilities that the server advertises later on with cap-notify are requested
+// as well if they are wanted.
+func WithCapabilities(caps ...string) Option {
+	return func(c *Client) { c.capWant = append(c.capWant, caps...) }
+}
+
 // WithChannel sets the channel that the client should join on connect, this can be called mupltiple times
 func WithChannel(ch string) Option {
 	return func(c *Client) {
@@ -24,39 +78,261 @@ func WithChannel(ch string) Option {
 	}
 }
 
-// WithConn sets the client connection, this can be omitted if you supply an address with WithAddr
+// WithClock replaces the source of time that is used for timeouts, timers, delays and rate limits, this is meant for
+// tests that need to control the time
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		if clock != nil {
+			c.clock = clock
+		}
+	}
+}
+
+// WithCommandPrefix sets the prefix of the bot commands that are registered with Command, the default is !
+func WithCommandPrefix(prefix string) Option {
+	return func(c *Client) {
+		if prefix != "" {
+			c.commandPrefix = prefix
+		}
+	}
+}
+
+// WithConn sets the client connection, this can be omitted if you supply an address with WithAddr. When the
+// connection is lost the client reconnects to the address set with WithAddr, or with the function set with
+// WithConnFactory. Without them the remote address of a TCP connection is used. If the connection is a
+// *tls.Conn the new connections use TLS as well, with the same server name. Use WithTLS or WithConnFactory if
+// the new connections need more of the TLS configuration, e.g. a client certificate or custom root CAs.
 func WithConn(conn net.Conn) Option {
 	return func(c *Client) {
 		c.conn = conn
-		c.addr = conn.RemoteAddr().String()
+	}
+}
+
+// WithConnFactory sets a function that is used to create the connection to the server, it is called on connect
+// and on each reconnect and takes precedence over WithAddr
+func WithConnFactory(fn func() (net.Conn, error)) Option {
+	return func(c *Client) {
+		c.connFactory = fn
+	}
+}
+
+// WithDCCAddr sets the IP address that is advertised in DCC offers, use this when the client is behind
+// NAT. By default the local address of the connection to the IRC server is used.
+func WithDCCAddr(ip net.IP) Option {
+	return func(c *Client) { c.dccIP = ip }
+}
+
+// WithDCCPortRange sets the range of ports that are used when we offer files with DCC SEND, by default
+// any available port is used
+func WithDCCPortRange(min, max int) Option {
+	return func(c *Client) {
+		c.dccPortMin = min
+		c.dccPortMax = max
 	}
 }
 
 // WithDebug sets the debug flag, set this if you want to log the communication
 func WithDebug() Option {
-	return func(c *Client) { c.debug = true }
+	return WithDebugEnabled(true)
+}
+
+// WithDebugEnabled enables or disables logging of the communication, it is the same as calling SetDebug before
+// connecting. The communication is logged to os.Stderr unless another logger is set with WithLogger.
+func WithDebugEnabled(debug bool) Option {
+	return func(c *Client) { c.debug = debug }
+}
+
+// WithDedupWindow drops received messages that are dispatched again within the duration, such as the
+// messages that a bouncer plays back after a reconnect. Messages are identified by their msgid tag, or by
+// their server-time tag together with the sender and the rest of the line, messages without either are
+// never dropped. Zero, the default, disables the deduplication.
+func WithDedupWindow(d time.Duration) Option {
+	return func(c *Client) { c.dedupWindow = d }
+}
+
+// WithEncoding sets the encoding that the server uses, e.g. charmap.ISO8859_1 or charmap.Windows1252
+// from golang.org/x/text/encoding/charmap. Received lines are converted to UTF-8 and sent lines are
+// converted from UTF-8 to the encoding. By default lines are sent as UTF-8 and received lines that
+// aren't valid UTF-8 are treated as ISO8859-1.
+func WithEncoding(enc encoding.Encoding) Option {
+	return func(c *Client) { c.encoding = enc }
+}
+
+// WithIdent answers the ident (RFC 1413) queries of the server with the username, a small ident responder is
+// started when we connect and stopped when we quit. The responder listens on port 113 unless another address is
+// set with WithIdentAddr, binding to port 113 usually requires root privileges or a capability such as
+// CAP_NET_BIND_SERVICE. The client connects anyway if the responder can't be started.
+func WithIdent(username string) Option {
+	return func(c *Client) { c.identUser = username }
+}
+
+// WithIdentAddr sets the address that the ident responder listens on, e.g. :1113 when port 113 is forwarded to
+// another port by a firewall
+func WithIdentAddr(addr string) Option {
+	return func(c *Client) { c.identAddr = addr }
 }
 
-// WithLogger sets the logger
+// WithLogger sets the logger that the communication is logged to when debug is enabled, the default logger
+// writes to os.Stderr
 func WithLogger(logger *log.Logger) Option {
 	return func(c *Client) { c.logger = logger }
 }
 
+// WithMaxLineLength sets the maximum length of the lines that are sent to the server, excluding CR-LF.
+// Longer lines are truncated and messages are split to fit. This takes precedence over the LINELEN that
+// the server advertises, the default is 510 and n is raised to at least 128.
+func WithMaxLineLength(n int) Option {
+	return func(c *Client) {
+		if n < minLineLength {
+			n = minLineLength
+		}
+		c.lineLength = n
+	}
+}
+
+// WithNamesCacheTTL caches the replies to the NAMES requests that Names makes for the duration, channels that we
+// are in are never requested since their members are known anyway. Zero, the default, disables the cache.
+func WithNamesCacheTTL(d time.Duration) Option {
+	return func(c *Client) { c.namesCacheTTL = d }
+}
+
+// WithNetsplitDetection dispatches the QUITs of a netsplit as a single NETSPLIT message, and the JOINs of the
+// nicks when they return as a single NETJOIN message, instead of one message per nick. A QUIT is part of a
+// netsplit if the reason is the names of two servers. The nicks are collected for the duration of the window
+// before the message is dispatched, the message has the servers as parameters and the nicks as text. Zero
+// disables the detection, which is the default.
+func WithNetsplitDetection(window time.Duration) Option {
+	return func(c *Client) { c.netsplitWindow = window }
+}
+
 // WithNick sets the nick for the client
 func WithNick(n string) Option {
 	return func(c *Client) { c.nick = n }
 }
 
+// WithNickServ sets the password that the client uses to identify with NickServ after connecting
+func WithNickServ(password string) Option {
+	return func(c *Client) { c.nickServPassword = password }
+}
+
+// WithNoAutoPong disables the automatic PONG replies to PINGs from the server, the PINGs must be
+// answered by a handler instead or the server will eventually close the connection
+func WithNoAutoPong() Option {
+	return func(c *Client) { c.noAutoPong = true }
+}
+
+// WithNickServNick sets the nick of the NickServ service, it defaults to NickServ
+func WithNickServNick(nick string) Option {
+	return func(c *Client) { c.nickServ = nick }
+}
+
+// WithNickServRegisterCommand sets the command that RegisterAccount sends to NickServ, {password} and
+// {email} are replaced with the password and email. It defaults to "REGISTER {password} {email}".
+func WithNickServRegisterCommand(cmd string) Option {
+	return func(c *Client) { c.nickServRegister = cmd }
+}
+
+// WithNoTruncate sends lines that are longer than the maximum line length as they are instead of truncating
+// them, which is useful for proxies that forward lines verbatim. Messages that Privmsg and friends send are
+// still split to fit. Most servers either cut long lines themselves or close the connection, so the caller is
+// responsible for keeping the lines within the limit.
+func WithNoTruncate() Option {
+	return func(c *Client) { c.noTruncate = true }
+}
+
+// WithProxyProtocol makes the client send a PROXY protocol v1 header with the given source and destination
+// addresses as soon as it has connected, before the registration. The addresses are IP:port pairs.
+func WithProxyProtocol(srcAddr, dstAddr string) Option {
+	return func(c *Client) {
+		c.proxySrc = srcAddr
+		c.proxyDst = dstAddr
+	}
+}
+
 // WithRealName sets the real name for the client
 func WithRealName(r string) Option {
 	return func(c *Client) { c.realName = r }
 }
 
+// WithRegistrationTimeout closes the connection if the server hasn't completed the registration within the
+// duration after we connected, the connection is treated as lost and the client tries to reconnect. Zero, the
+// default, waits forever.
+func WithRegistrationTimeout(d time.Duration) Option {
+	return func(c *Client) { c.registrationTimeout = d }
+}
+
+// WithReplaceInvalidUTF8 replaces invalid UTF-8 sequences in the parsed fields of received messages
+// with the unicode replacement character, Message.Raw still contains the line as it was received.
+// Without this option lines that aren't valid UTF-8 are treated as ISO8859-1.
+func WithReplaceInvalidUTF8() Option {
+	return func(c *Client) { c.replaceInvalidUTF8 = true }
+}
+
+// WithSASL sets the credentials that are used to authenticate with SASL PLAIN during the registration.
+// If multiple SASL mechanisms are configured the strongest one that the server supports is used first.
+func WithSASL(user, password string) Option {
+	return func(c *Client) { c.sasl = append(c.sasl, &saslPlain{user, password}) }
+}
+
+// WithSASLExternal authenticates with SASL EXTERNAL during the registration, the server uses the
+// client certificate of the TLS connection to authenticate us
+func WithSASLExternal() Option {
+	return func(c *Client) { c.sasl = append(c.sasl, &saslExternal{}) }
+}
+
+// WithSASLScram sets the credentials that are used to authenticate with SASL SCRAM-SHA-256 during the
+// registration, the authentication only succeeds if the server proves that it knows the password as well
+func WithSASLScram(user, password string) Option {
+	return func(c *Client) { c.sasl = append(c.sasl, newSaslScram(user, password)) }
+}
+
+// WithSendQueue holds up to size messages that are sent while the client is disconnected and sends them
+// once it has reconnected and joined its channels. Only PRIVMSG, NOTICE and TAGMSG lines are held, other
+// lines return ErrNotConnected, and the queue is cleared by Quit. When the queue is full the oldest line is
+// dropped if dropOldest is true, otherwise the send returns an error.
+func WithSendQueue(size int, dropOldest bool) Option {
+	return func(c *Client) {
+		c.sendQueueSize = size
+		c.sendQueueDropOldest = dropOldest
+	}
+}
+
+// WithTargetRate limits the messages that are sent with Privmsg and Notice to each target to the given number
+// of messages per duration, bursts of up to that many messages are allowed. Each target is limited on its
+// own, so a busy channel doesn't slow down the messages to other targets.
+func WithTargetRate(messages int, per time.Duration) Option {
+	return func(c *Client) {
+		c.targetMessages = messages
+		c.targetPer = per
+	}
+}
+
+// WithTLS makes the connections to the address set with WithAddr use TLS with the configuration
+func WithTLS(config *tls.Config) Option {
+	return func(c *Client) { c.tlsConfig = config }
+}
+
 // WithUser sets the user for the client
 func WithUser(u string) Option {
 	return func(c *Client) { c.user = u }
 }
 
+// WithUserModes sets user modes, e.g. +iB, that are set once the client is registered. This can be
+// called multiple times, all modes are combined into a single MODE command.
+func WithUserModes(modes string) Option {
+	return func(c *Client) { c.userModes = append(c.userModes, modes) }
+}
+
+// WithUserRegMode sets the mode bitmask that is sent in the USER command during the registration, as defined
+// in RFC 2812. Bit 2 (4) sets +w and bit 3 (8) sets +i. Zero, the default, sends * in its place.
+func WithUserRegMode(mask int) Option {
+	return func(c *Client) {
+		if mask > 0 {
+			c.userRegMode = mask
+		}
+	}
+}
+
 // WithVersion sets the CTCP VERSION reply string
 func WithVersion(v string) Option {
 	return func(c *Client) { c.version = v }
@@ -0,0 +1,34 @@
+package irc
+
+import (
+	"time"
+)
+
+// Ping sends a PING with the token to the server, the time it takes for the
+// server to reply with a PONG is available through Lag.
+func (c *Client) Ping(token string) error {
+	c.infoMu.Lock()
+	c.pings[token] = c.clock.Now()
+	c.infoMu.Unlock()
+
+	return c.Sendf("PING :%s", token)
+}
+
+// Lag returns the round trip time of the latest PING that was sent with Ping
+// and answered by the server, zero is returned if no PING has been answered.
+func (c *Client) Lag() time.Duration {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.lag
+}
+
+// handlePong updates the lag if the PONG is a reply to one of our PINGs.
+// The caller must hold infoMu.
+func (c *Client) handlePong(m *Message) {
+	// <server> :<token>
+	token := m.Text()
+	if sent, ok := c.pings[token]; ok {
+		c.lag = c.clock.Now().Sub(sent)
+		delete(c.pings, token)
+	}
+}
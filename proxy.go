@@ -0,0 +1,36 @@
+package irc
+
+import (
+	"fmt"
+	"net"
+)
+
+// proxyHeader returns the PROXY protocol v1 header for the source and
+// destination addresses, both are host:port pairs with IP addresses of the
+// same family since the header has a single protocol for both
+func proxyHeader(src, dst string) (string, error) {
+	srcIP, srcPort, err := net.SplitHostPort(src)
+	if err != nil {
+		return "", err
+	}
+	dstIP, dstPort, err := net.SplitHostPort(dst)
+	if err != nil {
+		return "", err
+	}
+
+	s, d := net.ParseIP(srcIP), net.ParseIP(dstIP)
+	if s == nil || d == nil {
+		return "", fmt.Errorf("invalid PROXY addresses %s and %s", src, dst)
+	}
+
+	proto := "TCP6"
+	switch s4, d4 := s.To4(), d.To4(); {
+	case s4 != nil && d4 != nil:
+		proto, s, d = "TCP4", s4, d4
+	case s4 != nil || d4 != nil:
+		return "", fmt.Errorf("PROXY addresses %s and %s aren't of the same family", src, dst)
+	}
+
+	// PROXY <proto> <src ip> <dst ip> <src port> <dst port>
+	return fmt.Sprintf("PROXY %s %s %s %s %s", proto, s, d, srcPort, dstPort), nil
+}
@@ -0,0 +1,51 @@
+package irc
+
+import (
+	"bufio"
+	"net/textproto"
+	"testing"
+)
+
+// TestProxyHeader tests the PROXY protocol v1 header
+func TestProxyHeader(t *testing.T) {
+	tests := []struct {
+		src, dst string
+		header   string
+		err      bool
+	}{
+		{"192.0.2.1:56324", "198.51.100.1:6667", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 6667", false},
+		{"[2001:db8::1]:56324", "[2001:db8::2]:6697", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 6697", false},
+		{"[::ffff:192.0.2.1]:56324", "198.51.100.1:6667", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 6667", false},
+		{"192.0.2.1:56324", "[2001:db8::2]:6697", "", true},
+		{"[2001:db8::1]:56324", "198.51.100.1:6667", "", true},
+		{"example.com:56324", "198.51.100.1:6667", "", true},
+		{"192.0.2.1", "198.51.100.1:6667", "", true},
+	}
+
+	for _, pt := range tests {
+		h, err := proxyHeader(pt.src, pt.dst)
+		if pt.err != (err != nil) {
+			t.Errorf("%s %s: unexpected error %v", pt.src, pt.dst, err)
+		}
+		if h != pt.header {
+			t.Errorf("%s %s: got %s, expected %s", pt.src, pt.dst, h, pt.header)
+		}
+	}
+}
+
+// TestProxyProtocol makes sure that the header is sent before anything else
+func TestProxyProtocol(t *testing.T) {
+	conn := newMockComm()
+	defer conn.Server.Close()
+
+	c := NewClient(WithConn(conn.Client), WithNick("foo"), WithProxyProtocol("192.0.2.1:56324", "198.51.100.1:6667"))
+	go c.Connect()
+
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	runScript(t, conn, tr, []string{
+		"CLI PROXY TCP4 192.0.2.1 198.51.100.1 56324 6667",
+		"CLI CAP LS 302",
+		"CLI USER foo * * :foo",
+		"CLI NICK foo",
+	})
+}
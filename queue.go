@@ -0,0 +1,75 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queuedLine is a line that is waiting to be sent
+type queuedLine struct {
+	line    string
+	secrets []string
+}
+
+// queueable returns true if the line is a message to a target, other lines
+// such as QUIT, PONG or the commands that the client sends by itself make no
+// sense on a later connection
+func queueable(line string) bool {
+	p := strings.Fields(line)
+	if len(p) > 0 && strings.HasPrefix(p[0], tagPrefix) {
+		p = p[1:]
+	}
+	if len(p) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(p[0]) {
+	case "PRIVMSG", "NOTICE", "TAGMSG":
+		return true
+	}
+	return false
+}
+
+// enqueue stores the line until we are connected again, it returns an error
+// if the queue is full and the oldest line shouldn't be dropped.
+// ErrNotConnected is returned if no send queue has been configured or if the
+// line isn't a message.
+func (c *Client) enqueue(line string, secrets []string) error {
+	if c.sendQueueSize == 0 || !queueable(line) {
+		return ErrNotConnected
+	}
+
+	c.sendQueueMu.Lock()
+	defer c.sendQueueMu.Unlock()
+
+	if len(c.sendQueue) >= c.sendQueueSize {
+		if !c.sendQueueDropOldest {
+			return fmt.Errorf("send queue is full")
+		}
+		c.log("send queue is full, dropping %s", redact(c.sendQueue[0].line, c.sendQueue[0].secrets...))
+		c.sendQueue = c.sendQueue[1:]
+	}
+
+	c.sendQueue = append(c.sendQueue, queuedLine{line, secrets})
+	return nil
+}
+
+// flushSendQueue sends all lines that were queued while we were
+// disconnected, in the order that they were queued
+func (c *Client) flushSendQueue() {
+	c.sendQueueMu.Lock()
+	queue := c.sendQueue
+	c.sendQueue = nil
+	c.sendQueueMu.Unlock()
+
+	for _, q := range queue {
+		c.send(q.line, q.secrets...)
+	}
+}
+
+// clearSendQueue drops all lines that are waiting to be sent
+func (c *Client) clearSendQueue() {
+	c.sendQueueMu.Lock()
+	c.sendQueue = nil
+	c.sendQueueMu.Unlock()
+}
@@ -0,0 +1,127 @@
+package irc
+
+import (
+	"errors"
+)
+
+// errRegistrationTimeout is the reason of the disconnect when the server
+// doesn't complete the registration in time
+var errRegistrationTimeout = errors.New("registration timed out")
+
+// RegistrationState is a step of the registration with the server
+type RegistrationState int
+
+// The steps of the registration, each step is reported at most once per
+// connection and the capability and SASL steps are only reported if the
+// capabilities are negotiated
+const (
+	RegistrationCapStarted RegistrationState = iota + 1
+	RegistrationCapFinished
+	RegistrationSASLStarted
+	RegistrationSASLSucceeded
+	RegistrationSASLFailed
+	RegistrationNickAccepted
+	RegistrationComplete
+)
+
+// String returns the name of the registration state
+func (s RegistrationState) String() string {
+	switch s {
+	case RegistrationCapStarted:
+		return "capability negotiation started"
+	case RegistrationCapFinished:
+		return "capability negotiation finished"
+	case RegistrationSASLStarted:
+		return "SASL authentication started"
+	case RegistrationSASLSucceeded:
+		return "SASL authentication succeeded"
+	case RegistrationSASLFailed:
+		return "SASL authentication failed"
+	case RegistrationNickAccepted:
+		return "nick accepted"
+	case RegistrationComplete:
+		return "registration complete"
+	}
+	return "unknown"
+}
+
+// OnRegistrationState registers a function that is called for each step of
+// the registration, this is useful to find out where a registration stalls
+func (c *Client) OnRegistrationState(fn func(state RegistrationState)) {
+	c.regMu.Lock()
+	c.regFns = append(c.regFns, fn)
+	c.regMu.Unlock()
+}
+
+// setRegistrationState reports the step of the registration unless it has
+// been reported already for this connection
+func (c *Client) setRegistrationState(s RegistrationState) {
+	c.regMu.Lock()
+	defer c.regMu.Unlock()
+
+	if c.regStates[s] {
+		return
+	}
+	c.regStates[s] = true
+
+	c.log("registration: %s", s)
+	for _, fn := range c.regFns {
+		go fn(s)
+	}
+}
+
+// resetRegistrationState forgets the steps that have been reported so that
+// they are reported again for the next connection
+func (c *Client) resetRegistrationState() {
+	c.regMu.Lock()
+	c.regStates = make(map[RegistrationState]bool)
+	c.regMu.Unlock()
+}
+
+// startRegistrationTimeout closes the connection if the registration hasn't
+// completed within the registration timeout, the main loop treats it as a
+// lost connection and reconnects
+func (c *Client) startRegistrationTimeout() {
+	if c.registrationTimeout <= 0 {
+		return
+	}
+
+	// Forget about a timeout of an earlier connection
+	select {
+	case <-c.regTimeout:
+	default:
+	}
+
+	c.infoMu.Lock()
+	gen := c.connGen
+	c.infoMu.Unlock()
+
+	go func() {
+		select {
+		case <-c.clock.After(c.registrationTimeout):
+		case <-c.done:
+			return
+		}
+
+		c.infoMu.Lock()
+		stalled := gen == c.connGen && !c.registered
+		c.infoMu.Unlock()
+		if !stalled {
+			return
+		}
+
+		c.writeMu.Lock()
+		conn := c.conn
+		c.writeMu.Unlock()
+		if conn == nil {
+			return
+		}
+
+		c.log("%s after %s", errRegistrationTimeout.Error(), c.registrationTimeout)
+		select {
+		case c.regTimeout <- true:
+		default:
+		}
+		conn.Close()
+	}()
+}
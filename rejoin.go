@@ -0,0 +1,61 @@
+package irc
+
+import (
+	"time"
+)
+
+// defaultAutoRejoinLimit is the default number of consecutive rejoins
+const defaultAutoRejoinLimit = 3
+
+// rejoinReset is the time after which a kick no longer counts as consecutive
+const rejoinReset = 5 * time.Minute
+
+// rejoin keeps track of the consecutive rejoins of a channel
+type rejoin struct {
+	count int
+	last  time.Time
+}
+
+// handleKick joins the channel again after the auto rejoin delay if we were
+// kicked from it, unless we have been kicked too many times in a row
+func (c *Client) handleKick(m *Message) {
+	// KICK <channel> <nick> :<reason>
+	if !c.autoRejoin || len(m.ParamsArray) < 2 {
+		return
+	}
+	ch := m.ParamsArray[0]
+
+	c.infoMu.Lock()
+	if c.casefold(m.ParamsArray[1]) != c.casefold(c.currentNick) {
+		c.infoMu.Unlock()
+		return
+	}
+
+	key := c.casefold(ch)
+	r := c.rejoins[key]
+	if c.clock.Now().Sub(r.last) > rejoinReset {
+		r.count = 0
+	}
+	r.count++
+	r.last = c.clock.Now()
+	c.rejoins[key] = r
+	gen := c.connGen
+	c.infoMu.Unlock()
+
+	if r.count > c.autoRejoinLimit {
+		c.log("kicked from %s %d times in a row, not rejoining", ch, r.count)
+		return
+	}
+
+	c.clock.Sleep(c.autoRejoinDelay)
+
+	// The channels are joined again anyway if we have reconnected
+	c.infoMu.Lock()
+	done := gen != c.connGen
+	c.infoMu.Unlock()
+	if done {
+		return
+	}
+
+	c.send("JOIN " + ch)
+}
@@ -0,0 +1,42 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenameChannel renames a channel, this requires the draft/channel-rename
+// capability. The server announces the rename with a RENAME message that is
+// dispatched to the RENAME event handlers.
+func (c *Client) RenameChannel(old, new, reason string) error {
+	c.infoMu.Lock()
+	enabled := c.capsEnabled["draft/channel-rename"]
+	c.infoMu.Unlock()
+
+	if !enabled {
+		return fmt.Errorf("the draft/channel-rename capability is not enabled")
+	}
+
+	if reason == "" {
+		return c.Sendf("RENAME %s %s", old, new)
+	}
+	return c.Sendf("RENAME %s %s :%s", old, new, reason)
+}
+
+// handleRename updates the channels that we are in when a channel that we
+// are in is renamed
+func (c *Client) handleRename(m *Message) {
+	// RENAME <old> <new> :<reason>
+	if len(m.ParamsArray) < 2 {
+		return
+	}
+	old := m.ParamsArray[0]
+	new := strings.TrimPrefix(m.ParamsArray[1], prefix)
+
+	if i := c.channelIndex(c.channels, old); i >= 0 {
+		c.channels[i] = new
+	}
+	if i := c.channelIndex(c.joined, old); i >= 0 {
+		c.joined[i] = new
+	}
+}
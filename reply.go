@@ -0,0 +1,72 @@
+package irc
+
+import (
+	"strings"
+)
+
+// StandardReply is an IRCv3 standard reply, FAIL, WARN or NOTE
+type StandardReply struct {
+	// Severity is FAIL, WARN or NOTE
+	Severity string
+
+	// Command is the command that the reply concerns, * if it doesn't
+	// concern a specific command
+	Command string
+
+	// Code is a machine readable code, e.g. ACCOUNT_REQUIRED
+	Code string
+
+	// Context contains the optional context parameters
+	Context []string
+
+	// Description is the human readable description
+	Description string
+
+	// Label is the label of the command that the reply belongs to if the
+	// labeled-response capability is used
+	Label string
+}
+
+// parseStandardReply parses a FAIL, WARN or NOTE message
+func parseStandardReply(m *Message) (*StandardReply, bool) {
+	switch m.Command {
+	case "FAIL", "WARN", "NOTE":
+	default:
+		return nil, false
+	}
+
+	// <command> <code> [<context>...] :<description>
+	var params []string
+	for _, p := range m.ParamsArray {
+		if strings.Index(p, prefix) == 0 {
+			break
+		}
+		params = append(params, p)
+	}
+	if len(params) < 2 {
+		return nil, false
+	}
+
+	return &StandardReply{
+		Severity:    m.Command,
+		Command:     params[0],
+		Code:        params[1],
+		Context:     params[2:],
+		Description: m.Text(),
+		Label:       m.Tags["label"],
+	}, true
+}
+
+// OnStandardReply registers a function that is called for each FAIL, WARN
+// and NOTE standard reply that the server sends
+func (c *Client) OnStandardReply(fn func(r *StandardReply)) {
+	h := func(m *Message) {
+		if r, ok := parseStandardReply(m); ok {
+			fn(r)
+		}
+	}
+
+	c.Handle("FAIL", h)
+	c.Handle("WARN", h)
+	c.Handle("NOTE", h)
+}
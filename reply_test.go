@@ -0,0 +1,69 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+// standardReplyTests contains the standard reply test cases
+var standardReplyTests = []struct {
+	name  string
+	raw   string
+	reply *StandardReply
+}{
+	{
+		name: "fail",
+		raw:  "@label=abc :irc.example.net FAIL CHATHISTORY MESSAGE_ERROR the_given_command #foo :Messages could not be retrieved",
+		reply: &StandardReply{
+			Severity:    "FAIL",
+			Command:     "CHATHISTORY",
+			Code:        "MESSAGE_ERROR",
+			Context:     []string{"the_given_command", "#foo"},
+			Description: "Messages could not be retrieved",
+			Label:       "abc",
+		},
+	},
+	{
+		name: "warn",
+		raw:  ":irc.example.net WARN REHASH CERTS_EXPIRED :Certificate has expired",
+		reply: &StandardReply{
+			Severity:    "WARN",
+			Command:     "REHASH",
+			Code:        "CERTS_EXPIRED",
+			Context:     []string{},
+			Description: "Certificate has expired",
+		},
+	},
+	{
+		name: "note",
+		raw:  ":irc.example.net NOTE * OPER_MESSAGE :The message",
+		reply: &StandardReply{
+			Severity:    "NOTE",
+			Command:     "*",
+			Code:        "OPER_MESSAGE",
+			Context:     []string{},
+			Description: "The message",
+		},
+	},
+	{
+		name: "not a standard reply",
+		raw:  ":irc.example.net NOTICE * :The message",
+	},
+}
+
+// TestStandardReply tests parsing of standard replies
+func TestStandardReply(t *testing.T) {
+	for _, st := range standardReplyTests {
+		t.Run(st.name, func(t *testing.T) {
+			m, err := parse(st.raw)
+			if err != nil {
+				t.Fatalf("%s: unable to parse message: %v", st.name, err)
+			}
+
+			r, _ := parseStandardReply(m)
+			if !reflect.DeepEqual(r, st.reply) {
+				t.Errorf("%s: got %#v, expected %#v", st.name, r, st.reply)
+			}
+		})
+	}
+}
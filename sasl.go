@@ -0,0 +1,266 @@
+package irc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// saslChunkSize is the maximum size of the payload of an AUTHENTICATE message
+const saslChunkSize = 400
+
+// saslMechanism is implemented by the supported SASL mechanisms
+type saslMechanism interface {
+	// Name returns the name of the mechanism
+	Name() string
+
+	// Next returns the response to a challenge from the server
+	Next(challenge []byte) ([]byte, error)
+
+	// reset prepares the mechanism for a new authentication
+	reset()
+}
+
+// saslPlain implements the PLAIN mechanism
+type saslPlain struct {
+	user     string
+	password string
+}
+
+func (s *saslPlain) Name() string { return "PLAIN" }
+
+func (s *saslPlain) reset() {}
+
+func (s *saslPlain) Next(challenge []byte) ([]byte, error) {
+	return []byte(s.user + "\x00" + s.user + "\x00" + s.password), nil
+}
+
+// saslExternal implements the EXTERNAL mechanism
+type saslExternal struct{}
+
+func (s *saslExternal) Name() string { return "EXTERNAL" }
+
+func (s *saslExternal) reset() {}
+
+func (s *saslExternal) Next(challenge []byte) ([]byte, error) {
+	return nil, nil
+}
+
+// ErrSASLUnsupported is the SASL error when the server doesn't support any of
+// the configured mechanisms
+var ErrSASLUnsupported = errors.New("the server doesn't support any of the configured SASL mechanisms")
+
+// saslStrength ranks the mechanisms, the strongest mechanism is tried first
+var saslStrength = map[string]int{
+	"EXTERNAL":      3,
+	"SCRAM-SHA-256": 2,
+	"PLAIN":         1,
+}
+
+// saslFilter returns the configured mechanisms that are in the list of
+// mechanisms that the server supports, ordered by strength. All configured
+// mechanisms are returned if the server doesn't tell us what it supports.
+// The caller must hold infoMu.
+func (c *Client) saslFilter(supported string) []saslMechanism {
+	var mechs []saslMechanism
+	for _, m := range c.sasl {
+		if supported == "" || indexOf(strings.Split(supported, ","), m.Name()) >= 0 {
+			mechs = append(mechs, m)
+		}
+	}
+
+	sort.SliceStable(mechs, func(i, j int) bool {
+		return saslStrength[mechs[i].Name()] > saslStrength[mechs[j].Name()]
+	})
+	return mechs
+}
+
+// SASLMechanism returns the name of the SASL mechanism that was used during
+// the latest registration, it is empty if SASL wasn't used
+func (c *Client) SASLMechanism() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	if c.saslCurrent == nil {
+		return ""
+	}
+	return c.saslCurrent.Name()
+}
+
+// SASLError returns the reason that the SASL authentication of the latest
+// registration failed, it is nil if it didn't fail. ErrSASLUnsupported is
+// returned if none of the configured mechanisms could be tried.
+func (c *Client) SASLError() error {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.saslErr
+}
+
+// saslStart starts the authentication if the server has acknowledged the
+// sasl capability and we have credentials, it returns false if there's
+// nothing to authenticate with.
+func (c *Client) saslStart() bool {
+	c.infoMu.Lock()
+	start := len(c.sasl) > 0 && c.capsEnabled["sasl"] && !c.registered
+	if start {
+		c.saslCandidates = c.saslFilter(c.capsAvailable["sasl"])
+	}
+	unsupported := start && len(c.saslCandidates) == 0
+	if unsupported {
+		c.saslErr = ErrSASLUnsupported
+	}
+	c.infoMu.Unlock()
+
+	if !start {
+		return false
+	}
+
+	// Don't wait for an authentication that can't happen, the server
+	// told us which mechanisms it supports
+	if unsupported {
+		c.log("SASL authentication failed: %s", ErrSASLUnsupported.Error())
+		c.setRegistrationState(RegistrationSASLFailed)
+		return false
+	}
+
+	c.setRegistrationState(RegistrationSASLStarted)
+	return c.saslNext()
+}
+
+// saslNext starts the authentication with the next candidate mechanism, it
+// returns false if there are no mechanisms left to try
+func (c *Client) saslNext() bool {
+	c.infoMu.Lock()
+	if len(c.saslCandidates) == 0 {
+		c.infoMu.Unlock()
+		return false
+	}
+	mech := c.saslCandidates[0]
+	c.saslCandidates = c.saslCandidates[1:]
+	c.saslCurrent = mech
+	c.saslIn.Reset()
+	c.infoMu.Unlock()
+
+	c.log("authenticating with SASL %s", mech.Name())
+	mech.reset()
+	c.send("AUTHENTICATE " + mech.Name())
+	return true
+}
+
+// updateSASL collects the chunks of an AUTHENTICATE message from the server,
+// the caller must hold infoMu
+func (c *Client) updateSASL(m *Message) {
+	if len(m.ParamsArray) == 0 || m.ParamsArray[0] == "+" {
+		return
+	}
+	c.saslIn.WriteString(m.ParamsArray[0])
+}
+
+// handleAuthenticate replies to a challenge from the server once all the
+// chunks of it have been received
+func (c *Client) handleAuthenticate(m *Message) {
+	if len(m.ParamsArray) == 0 || len(m.ParamsArray[0]) == saslChunkSize {
+		return
+	}
+
+	c.infoMu.Lock()
+	encoded := c.saslIn.String()
+	c.saslIn.Reset()
+	mech := c.saslCurrent
+	c.infoMu.Unlock()
+
+	if mech == nil {
+		return
+	}
+
+	challenge, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		c.log("invalid SASL challenge: %s", err.Error())
+		c.send("AUTHENTICATE *")
+		return
+	}
+
+	resp, err := mech.Next(challenge)
+	if err != nil {
+		c.log("SASL %s: %s", mech.Name(), err.Error())
+		c.send("AUTHENTICATE *")
+		return
+	}
+
+	c.saslSend(resp)
+}
+
+// saslSend sends the response to the server, it is split into chunks of 400
+// bytes and if the last chunk is exactly 400 bytes it is followed by an
+// empty AUTHENTICATE to mark the end of the response. The response is
+// redacted from the debug log since it contains credentials.
+func (c *Client) saslSend(resp []byte) error {
+	for _, chunk := range saslChunks(base64.StdEncoding.EncodeToString(resp)) {
+		if err := c.send(fmt.Sprintf("AUTHENTICATE %s", chunk), strings.TrimPrefix(chunk, "+")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saslChunks splits the encoded response into AUTHENTICATE payloads
+func saslChunks(encoded string) []string {
+	var chunks []string
+	for len(encoded) >= saslChunkSize {
+		chunks = append(chunks, encoded[:saslChunkSize])
+		encoded = encoded[saslChunkSize:]
+	}
+
+	// An empty last chunk is sent as +
+	if encoded == "" {
+		encoded = "+"
+	}
+	return append(chunks, encoded)
+}
+
+// handleSASLResult ends the capability negotiation when the authentication
+// has succeeded or failed, if it failed the next mechanism is tried first
+func (c *Client) handleSASLResult(m *Message) {
+	if m.Command != "903" {
+		c.log("SASL authentication failed: %s", m.Text())
+	}
+
+	if m.Command == "904" && c.saslNext() {
+		return
+	}
+
+	c.infoMu.Lock()
+	if m.Command == "903" {
+		c.saslErr = nil
+	} else {
+		c.saslErr = fmt.Errorf("SASL authentication failed: %s", m.Text())
+	}
+	c.infoMu.Unlock()
+
+	if m.Command == "903" {
+		c.setRegistrationState(RegistrationSASLSucceeded)
+	} else {
+		c.setRegistrationState(RegistrationSASLFailed)
+	}
+	c.capEnd()
+}
+
+// updateSASLMechanisms narrows down the mechanisms that we try to the ones
+// that the server lists in RPL_SASLMECHS (908), the caller must hold infoMu
+func (c *Client) updateSASLMechanisms(m *Message) {
+	// <me> <mechanisms> :are available SASL mechanisms
+	if len(m.ParamsArray) < 2 {
+		return
+	}
+
+	supported := strings.Split(m.ParamsArray[1], ",")
+	var mechs []saslMechanism
+	for _, mech := range c.saslCandidates {
+		if indexOf(supported, mech.Name()) >= 0 {
+			mechs = append(mechs, mech)
+		}
+	}
+	c.saslCandidates = mechs
+}
@@ -0,0 +1,149 @@
+package irc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxScramIterations is the highest iteration count that we accept from the
+// server, a malicious server could otherwise keep us busy for a long time
+const maxScramIterations = 1 << 20
+
+// saslScram implements the SCRAM-SHA-256 mechanism as described in RFC 7677
+type saslScram struct {
+	user     string
+	password string
+
+	// nonce returns the client nonce, it is replaced by the tests
+	nonce func() string
+
+	step            int
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// newSaslScram creates a new SCRAM-SHA-256 mechanism
+func newSaslScram(user, password string) *saslScram {
+	return &saslScram{
+		user:     user,
+		password: password,
+		nonce: func() string {
+			b := make([]byte, 18)
+			rand.Read(b)
+			return base64.RawStdEncoding.EncodeToString(b)
+		},
+	}
+}
+
+func (s *saslScram) Name() string { return "SCRAM-SHA-256" }
+
+func (s *saslScram) reset() {
+	s.step = 0
+	s.clientNonce = ""
+	s.clientFirstBare = ""
+	s.serverSignature = nil
+}
+
+func (s *saslScram) Next(challenge []byte) ([]byte, error) {
+	s.step++
+
+	switch s.step {
+	case 1:
+		// client-first-message
+		s.clientNonce = s.nonce()
+		user := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s.user)
+		s.clientFirstBare = fmt.Sprintf("n=%s,r=%s", user, s.clientNonce)
+		return []byte("n,," + s.clientFirstBare), nil
+
+	case 2:
+		// server-first-message, r=<nonce>,s=<salt>,i=<iterations>
+		serverFirst := string(challenge)
+		attrs := scramAttributes(serverFirst)
+		nonce := attrs["r"]
+		if !strings.HasPrefix(nonce, s.clientNonce) || len(nonce) == len(s.clientNonce) {
+			return nil, fmt.Errorf("invalid server nonce")
+		}
+		salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid salt: %v", err)
+		}
+		iterations, err := strconv.Atoi(attrs["i"])
+		if err != nil || iterations < 1 {
+			return nil, fmt.Errorf("invalid iteration count %s", attrs["i"])
+		}
+		if iterations > maxScramIterations {
+			return nil, fmt.Errorf("too many iterations %d, the maximum is %d", iterations, maxScramIterations)
+		}
+
+		// client-final-message
+		clientFinal := "c=biws,r=" + nonce
+		authMessage := s.clientFirstBare + "," + serverFirst + "," + clientFinal
+
+		saltedPassword := pbkdf2SHA256([]byte(s.password), salt, iterations)
+		clientKey := hmacSHA256(saltedPassword, []byte("Client Key"))
+		storedKey := sha256.Sum256(clientKey)
+		clientSignature := hmacSHA256(storedKey[:], []byte(authMessage))
+		proof := make([]byte, len(clientKey))
+		for i := range clientKey {
+			proof[i] = clientKey[i] ^ clientSignature[i]
+		}
+
+		serverKey := hmacSHA256(saltedPassword, []byte("Server Key"))
+		s.serverSignature = hmacSHA256(serverKey, []byte(authMessage))
+
+		return []byte(clientFinal + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+
+	case 3:
+		// server-final-message, v=<signature> or e=<error>
+		attrs := scramAttributes(string(challenge))
+		if e, ok := attrs["e"]; ok {
+			return nil, fmt.Errorf("server error: %s", e)
+		}
+		v, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(v, s.serverSignature) {
+			return nil, fmt.Errorf("invalid server signature")
+		}
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unexpected challenge")
+}
+
+// scramAttributes parses the comma separated attributes of a SCRAM message
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, a := range strings.Split(msg, ",") {
+		if len(a) > 1 && a[1] == '=' {
+			attrs[a[:1]] = a[2:]
+		}
+	}
+	return attrs
+}
+
+// hmacSHA256 returns the HMAC-SHA-256 of data
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// pbkdf2SHA256 derives a key with PBKDF2 using HMAC-SHA-256, SCRAM only
+// needs the first block of the output
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	u := hmacSHA256(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+	result := make([]byte, len(u))
+	copy(result, u)
+	for i := 1; i < iterations; i++ {
+		u = hmacSHA256(password, u)
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package irc
+
+import (
+	"testing"
+)
+
+// TestScram tests the SCRAM-SHA-256 exchange with the test vector from RFC 7677
+func TestScram(t *testing.T) {
+	s := newSaslScram("user", "pencil")
+	s.nonce = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+
+	steps := []struct {
+		challenge string
+		response  string
+	}{
+		{
+			challenge: "",
+			response:  "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		},
+		{
+			challenge: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			response:  "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		},
+		{
+			challenge: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+			response:  "",
+		},
+	}
+
+	for i, st := range steps {
+		resp, err := s.Next([]byte(st.challenge))
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i+1, err)
+		}
+		if string(resp) != st.response {
+			t.Errorf("step %d: got %s, expected %s", i+1, resp, st.response)
+		}
+	}
+}
+
+// TestScramInvalidServerSignature makes sure that a server that doesn't know the password is rejected
+func TestScramInvalidServerSignature(t *testing.T) {
+	s := newSaslScram("user", "pencil")
+	s.nonce = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+
+	s.Next(nil)
+	s.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if _, err := s.Next([]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err == nil {
+		t.Errorf("an invalid server signature should be rejected")
+	}
+}
+
+// TestScramTooManyIterations makes sure that a server can't make us spend a
+// long time hashing the password
+func TestScramTooManyIterations(t *testing.T) {
+	s := newSaslScram("user", "pencil")
+	s.nonce = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+
+	s.Next(nil)
+	if _, err := s.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=2000000000")); err == nil {
+		t.Errorf("a huge iteration count should be rejected")
+	}
+}
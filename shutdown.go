@@ -0,0 +1,58 @@
+package irc
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// signalStopped tells Shutdown that the main loop has ended, the ident
+// responder isn't needed anymore either
+func (c *Client) signalStopped() {
+	c.stopIdent()
+
+	select {
+	case c.stopped <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown sends a QUIT with the message to the server and waits until the
+// server has closed the connection and the main loop has ended. If that
+// doesn't happen before the context is done the connection is closed by us.
+// All timers and goroutines that belong to the connection are stopped, the
+// client can't be used after it has been shut down.
+func (c *Client) Shutdown(ctx context.Context, message string) error {
+	// Forget about any earlier stop of the main loop
+	select {
+	case <-c.stopped:
+	default:
+	}
+
+	c.writeMu.Lock()
+	conn := c.conn
+	c.writeMu.Unlock()
+
+	// Quit writes the QUIT before it asks the main loop to quit, so the
+	// QUIT goes out before the connection is closed
+	c.Quit(message)
+	c.closeOnce.Do(func() { close(c.done) })
+
+	// There is nothing more to wait for if the main loop isn't running
+	if conn == nil || atomic.LoadInt32(&c.running) == 0 {
+		return nil
+	}
+
+	var err error
+	select {
+	case <-c.stopped:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// The server didn't close the connection in time, closing it makes
+	// the main loop end
+	conn.Close()
+	<-c.stopped
+	return err
+}
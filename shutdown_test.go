@@ -0,0 +1,122 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// TestShutdown makes sure that Shutdown ends the connection and that no
+// goroutines are left behind
+func TestShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	c, conn, tr := newTestClient(WithAutoReclaim(time.Minute), WithAutoAway(time.Minute, "idle"))
+
+	runScript(t, conn, tr, []string{
+		"SRV :irc.example.net 433 * foo :Nickname already in use",
+		"CLI NICK foo_",
+		"SRV :irc.example.net 001 foo_ :Welcome",
+	})
+
+	errCh := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		errCh <- c.Shutdown(ctx, "bye")
+	}()
+
+	// Read until the QUIT and close the connection like a server would
+	for {
+		l, err := tr.ReadLine()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if l == "QUIT :bye" {
+			break
+		}
+	}
+	conn.Server.Close()
+
+	if err := <-errCh; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestShutdownTimeout makes sure that the connection is closed by us if the
+// server doesn't close it in time
+func TestShutdownTimeout(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	go func() {
+		for {
+			if _, err := tr.ReadLine(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx, "bye"); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+// TestShutdownQuitFirst makes sure that the QUIT is written before the quit
+// is signalled, and that the server closing the connection because of it
+// isn't treated as a lost connection
+func TestShutdownQuitFirst(t *testing.T) {
+	conn := newMockComm()
+	var n int32
+	c := NewClient(WithNick("foo"), WithConnFactory(func() (net.Conn, error) {
+		if atomic.AddInt32(&n, 1) > 1 {
+			return nil, fmt.Errorf("reconnected")
+		}
+		return conn.Client, nil
+	}))
+
+	disconnects := make(chan string, 1)
+	c.OnDisconnect(func(reason string) { disconnects <- reason })
+
+	go c.Connect()
+	tr := textproto.NewReader(bufio.NewReader(conn.Server))
+	for {
+		if l, err := tr.ReadLine(); err != nil || strings.HasPrefix(l, "NICK ") {
+			break
+		}
+	}
+
+	errCh := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		errCh <- c.Shutdown(ctx, "bye")
+	}()
+
+	if l, _ := tr.ReadLine(); l != "QUIT :bye" {
+		t.Fatalf("got %q, expected the QUIT", l)
+	}
+	conn.Server.Close()
+
+	if err := <-errCh; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&n); n != 1 {
+		t.Errorf("expected 1 connection attempt, got %d", n)
+	}
+	select {
+	case reason := <-disconnects:
+		t.Errorf("unexpected disconnect %q", reason)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
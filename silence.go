@@ -0,0 +1,104 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Silence adds the masks to the server side ignore list, the server drops all
+// private messages and notices from users that match a mask before they are
+// sent to us. An error is returned if the server doesn't advertise SILENCE
+// support or if the masks don't fit within the advertised limit.
+func (c *Client) Silence(masks ...string) error {
+	c.infoMu.Lock()
+	limit, ok := c.isupport["SILENCE"]
+	count := len(c.silenced)
+	c.infoMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("the server doesn't support SILENCE")
+	}
+	if n, err := strconv.Atoi(limit); err == nil && count+len(masks) > n {
+		return fmt.Errorf("the SILENCE list is limited to %d entries", n)
+	}
+
+	for _, m := range masks {
+		if err := c.Sendf("SILENCE +%s", m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unsilence removes the masks from the server side ignore list
+func (c *Client) Unsilence(masks ...string) error {
+	for _, m := range masks {
+		if err := c.Sendf("SILENCE -%s", m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SilenceList requests the server side ignore list and returns it, the list
+// is made of the 271 replies and ends with 272. Numeric 261 isn't part of the
+// reply, it is RPL_TRACELOG and no server uses it for SILENCE.
+func (c *Client) SilenceList() ([]string, error) {
+	w := c.wait(func(m *Message) bool {
+		return m.Command == "271" || m.Command == "272"
+	})
+	defer c.stopWait(w)
+
+	if err := c.Sendf("SILENCE"); err != nil {
+		return nil, err
+	}
+
+	var masks []string
+	timeout := c.clock.After(replyTimeout)
+	for {
+		select {
+		case m := <-w.ch:
+			// 271 <me> <nick> <mask>
+			if m.Command == "271" && len(m.ParamsArray) > 2 {
+				masks = append(masks, m.ParamsArray[len(m.ParamsArray)-1])
+				continue
+			}
+
+			// 272 <me> :End of Silence List
+			if m.Command == "272" {
+				c.infoMu.Lock()
+				c.silenced = masks
+				c.infoMu.Unlock()
+				return masks, nil
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for the SILENCE list")
+		}
+	}
+}
+
+// handleSilence keeps track of the server side ignore list, the server
+// confirms each change with a SILENCE message from us. The caller must hold
+// infoMu.
+func (c *Client) handleSilence(m *Message) {
+	if c.casefold(m.Name) != c.casefold(c.currentNick) || len(m.ParamsArray) == 0 {
+		return
+	}
+
+	for _, mask := range strings.Split(strings.TrimPrefix(m.ParamsArray[0], prefix), ",") {
+		switch {
+		case strings.HasPrefix(mask, "+"):
+			c.silenced = append(c.silenced, mask[1:])
+		case strings.HasPrefix(mask, "-"):
+			for i, s := range c.silenced {
+				if s == mask[1:] {
+					c.silenced = append(c.silenced[:i], c.silenced[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package irc
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// resetState resets the state that belongs to a connection, it is called
+// each time we connect to the server and when we quit
+func (c *Client) resetState() {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	// Goroutines that belong to a connection use the generation to know
+	// when the connection is gone
+	c.connGen++
+	atomic.StoreInt32(&c.quitting, 0)
+
+	// Set current nick to nick
+	// This is used so we can get our wanted nick back if it is taken during the connect
+	c.currentNick = c.nick
+	c.registered = false
+	c.isupport = make(map[string]string)
+	c.updateLineLength()
+	c.errorReason = ""
+	c.joined = nil
+	c.identifyRetries = make(map[string]bool)
+	c.banLists = make(map[string][]Ban)
+	c.pings = make(map[string]time.Time)
+	c.silenced = nil
+	c.capsAvailable = make(map[string]string)
+	c.capsEnabled = make(map[string]bool)
+	c.saslCandidates = nil
+	c.saslCurrent = nil
+	c.saslErr = nil
+	c.rejoins = make(map[string]rejoin)
+	c.members = make(map[string]map[string]*member)
+	c.awayUsers = make(map[string]string)
+	c.namesCache = make(map[string]namesEntry)
+	c.recentSends = make(map[string]time.Time)
+	c.netsplits = make(map[string]*netsplitBatch)
+	c.netjoins = make(map[string]*netsplitBatch)
+	c.splitNicks = make(map[string]splitNick)
+	c.historyBatches = make(map[string]bool)
+	c.joiningNicks = make(map[string]string)
+	c.resetRegistrationState()
+
+	// Lines that were buffered for an earlier connection must not be
+	// written ahead of the registration
+	c.writeMu.Lock()
+	c.discardWrites()
+	c.writeMu.Unlock()
+}
+
+// updateState updates the client state from a message that was received
+// from the server, it is called by the read loop before the message is
+// dispatched to the event handlers.
+func (c *Client) updateState(m *Message) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	// Messages of a chathistory batch are old, they must not change the
+	// state
+	if c.isHistory(m) {
+		return
+	}
+
+	// The members are updated first since the nick changes below
+	c.updateMembers(m)
+	c.updateAway(m)
+
+	switch m.Command {
+	case "001":
+		// 001 is the first message that the server sends after a
+		// successful registration, it also contains the nick that
+		// the server knows us by.
+		c.registered = true
+		c.setRegistrationState(RegistrationNickAccepted)
+		c.setRegistrationState(RegistrationComplete)
+		if len(m.ParamsArray) > 0 {
+			c.currentNick = m.ParamsArray[0]
+		}
+
+	case "005":
+		updateISupport(c.isupport, m)
+		c.updateLineLength()
+
+	case "367":
+		// Collect the ban list until it ends with 368
+		if b, ok := parseBan(m); ok {
+			key := c.casefold(b.Channel)
+			c.banLists[key] = append(c.banLists[key], b)
+		}
+
+	case "368":
+		// RPL_ENDOFBANLIST, <me> <channel> :End of channel ban list
+		if len(m.ParamsArray) < 2 {
+			return
+		}
+
+		key := c.casefold(m.ParamsArray[1])
+		bans := c.banLists[key]
+		delete(c.banLists, key)
+		for _, fn := range c.banListFns {
+			go fn(m.ParamsArray[1], bans)
+		}
+
+	case "JOIN":
+		if c.casefold(m.Name) != c.casefold(c.currentNick) || len(m.ParamsArray) == 0 {
+			return
+		}
+
+		// If we are joinning a channel we'll store the current user
+		// and current host in the client, this will be used to
+		// calculate the correct number of bytes that we are allowed
+		// to send to the server.
+		c.currentUser = m.User
+		c.currentHost = m.Host
+
+		// Remember the channel so that we can join it again after a
+		// reconnect.
+		ch := strings.TrimPrefix(m.ParamsArray[0], prefix)
+		if c.channelIndex(c.channels, ch) < 0 {
+			c.channels = append(c.channels, ch)
+		}
+		if c.channelIndex(c.joined, ch) < 0 {
+			c.joined = append(c.joined, ch)
+		}
+
+	case "NICK":
+		if c.casefold(m.Name) != c.casefold(c.currentNick) || len(m.ParamsArray) == 0 {
+			return
+		}
+
+		// The server confirmed a change of our nick
+		old := c.currentNick
+		c.currentNick = strings.TrimPrefix(m.ParamsArray[0], prefix)
+		for _, fn := range c.nickChangeFns {
+			go fn(old, c.currentNick)
+		}
+
+	case "CAP":
+		c.updateCaps(m)
+
+	case "BATCH":
+		c.updateHistoryBatches(m)
+
+	case "AUTHENTICATE":
+		c.updateSASL(m)
+
+	case "908":
+		c.updateSASLMechanisms(m)
+
+	case "SILENCE":
+		c.handleSilence(m)
+
+	case "PONG":
+		c.handlePong(m)
+
+	case "RENAME":
+		c.handleRename(m)
+
+	case "ERROR":
+		// The server tells us why it is about to close the
+		// connection, the reason is reported when the connection
+		// ends
+		c.errorReason = m.Text()
+		c.log("server closed the connection: %s", c.errorReason)
+
+	case "PART":
+		if c.casefold(m.Name) != c.casefold(c.currentNick) || len(m.ParamsArray) == 0 {
+			return
+		}
+
+		// We left the channel on purpose, so we shouldn't join it
+		// again after a reconnect.
+		ch := strings.TrimPrefix(m.ParamsArray[0], prefix)
+		c.channels = c.removeChannel(c.channels, ch)
+		c.joined = c.removeChannel(c.joined, ch)
+
+	case "KICK":
+		if len(m.ParamsArray) < 2 || c.casefold(m.ParamsArray[1]) != c.casefold(c.currentNick) {
+			return
+		}
+
+		// We didn't leave on purpose, so the channel is kept in the
+		// list of channels that we join after a reconnect.
+		c.joined = c.removeChannel(c.joined, m.ParamsArray[0])
+	}
+}
+
+// updateISupport updates the map with the tokens of a RPL_ISUPPORT message,
+// tokens that are prefixed with - are removed
+func updateISupport(isupport map[string]string, m *Message) {
+	// <me> <token> [<token> ...] :are supported
+	if len(m.ParamsArray) == 0 {
+		return
+	}
+
+	for _, t := range m.ParamsArray[1:] {
+		if strings.Index(t, prefix) == 0 {
+			break
+		}
+
+		if strings.Index(t, "-") == 0 {
+			delete(isupport, t[1:])
+			continue
+		}
+
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) == 2 {
+			isupport[kv[0]] = kv[1]
+		} else {
+			isupport[kv[0]] = ""
+		}
+	}
+}
+
+// indexOf returns the index of the string in the slice or -1 if it isn't
+// found, the comparison is case insensitive.
+func indexOf(values []string, v string) int {
+	for i, s := range values {
+		if strings.EqualFold(s, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// channelIndex returns the index of the channel in the slice or -1 if it
+// isn't found, channel names are compared with the case mapping of the
+// server. The caller must hold infoMu.
+func (c *Client) channelIndex(channels []string, ch string) int {
+	key := c.casefold(ch)
+	for i, s := range channels {
+		if c.casefold(s) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeChannel returns the slice without the channel, the caller must hold
+// infoMu
+func (c *Client) removeChannel(channels []string, ch string) []string {
+	if i := c.channelIndex(channels, ch); i >= 0 {
+		return append(channels[:i], channels[i+1:]...)
+	}
+	return channels
+}
+
+// Channels returns the channels that the client currently is in
+func (c *Client) Channels() []string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	channels := make([]string, len(c.joined))
+	copy(channels, c.joined)
+	return channels
+}
+
+// ISupport returns a copy of the ISUPPORT tokens that the server has
+// advertised, tokens without a value have an empty value
+func (c *Client) ISupport() map[string]string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+
+	isupport := make(map[string]string, len(c.isupport))
+	for k, v := range c.isupport {
+		isupport[k] = v
+	}
+	return isupport
+}
+
+// Network returns the name of the network as advertised by the NETWORK
+// ISUPPORT token, an empty string is returned if it isn't advertised
+func (c *Client) Network() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.isupport["NETWORK"]
+}
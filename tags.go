@@ -0,0 +1,167 @@
+package irc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tagEscaper escapes tag values as described in the message tags
+// specification
+var tagEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\:`,
+	" ", `\s`,
+	"\r", `\r`,
+	"\n", `\n`,
+)
+
+// parseTags parses the tags of a message, the leading @ must be removed
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, t := range strings.Split(s, ";") {
+		if t == "" {
+			continue
+		}
+
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = unescapeTag(kv[1])
+		} else {
+			tags[kv[0]] = ""
+		}
+	}
+	return tags
+}
+
+// unescapeTag unescapes a tag value, unknown escape sequences are replaced by
+// the escaped character and a trailing backslash is dropped
+func unescapeTag(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			b.WriteByte(v[i])
+			continue
+		}
+
+		i++
+		if i == len(v) {
+			break
+		}
+
+		switch v[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+// formatTags formats the tags so that they can be prepended to a message,
+// the tags are sorted by name so that the output is predictable
+func formatTags(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(tagPrefix)
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(name)
+		if v := tags[name]; v != "" {
+			b.WriteByte('=')
+			b.WriteString(tagEscaper.Replace(v))
+		}
+	}
+	return b.String()
+}
+
+// SendTagged sends a message with client tags prepended to it, the values
+// are escaped as required. Only client tags, which are prefixed with +, are
+// allowed, an error is returned for any other tag.
+func (c *Client) SendTagged(tags map[string]string, format string, args ...interface{}) error {
+	for name := range tags {
+		if !strings.HasPrefix(name, "+") {
+			return fmt.Errorf("%s is not a client tag", name)
+		}
+	}
+
+	return c.sendTagged(tags, fmt.Sprintf(format, args...))
+}
+
+// sendTagged sends the line with the tags prepended
+func (c *Client) sendTagged(tags map[string]string, line string) error {
+	c.touchAway(line)
+	if len(tags) == 0 {
+		return c.send(line)
+	}
+	return c.send(formatTags(tags) + " " + line)
+}
+
+// Reply sends a message to the target as a reply to the message with the
+// msgid, this requires the message-tags capability
+func (c *Client) Reply(target, msgid, text string) error {
+	return c.sendTagged(map[string]string{"+draft/reply": msgid}, fmt.Sprintf("PRIVMSG %s :%s", target, text))
+}
+
+// TagMsg sends a TAGMSG, a message that only consists of tags, to the
+// target. Only client tags, which are prefixed with +, are allowed. This
+// requires the message-tags capability.
+func (c *Client) TagMsg(target string, tags map[string]string) error {
+	return c.SendTagged(tags, "TAGMSG %s", target)
+}
+
+// OnTagMsg registers a function that is called for each TAGMSG that we
+// receive
+func (c *Client) OnTagMsg(fn func(from, target string, tags map[string]string)) {
+	c.Handle("TAGMSG", func(m *Message) {
+		if len(m.ParamsArray) == 0 {
+			return
+		}
+		fn(m.Name, strings.TrimPrefix(m.ParamsArray[0], prefix), m.Tags)
+	})
+}
+
+// React reacts to the message with the msgid, e.g. with an emoji, this
+// requires the message-tags capability
+func (c *Client) React(target, msgid, reaction string) error {
+	return c.TagMsg(target, map[string]string{
+		"+draft/reply": msgid,
+		"+draft/react": reaction,
+	})
+}
+
+// Typing tells the target that we are typing, the state is either active,
+// paused or done. This requires the message-tags capability.
+func (c *Client) Typing(target, state string) error {
+	switch state {
+	case "active", "paused", "done":
+	default:
+		return fmt.Errorf("invalid typing state %s", state)
+	}
+
+	return c.TagMsg(target, map[string]string{"+typing": state})
+}
+
+// OnTyping registers a function that is called when someone tells us that
+// they are typing, state is either active, paused or done
+func (c *Client) OnTyping(fn func(from, target, state string)) {
+	c.OnTagMsg(func(from, target string, tags map[string]string) {
+		if state, ok := tags["+typing"]; ok {
+			fn(from, target, state)
+		}
+	})
+}
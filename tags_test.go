@@ -0,0 +1,106 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFormatTags tests that tags are formatted and escaped
+func TestFormatTags(t *testing.T) {
+	tags := map[string]string{
+		"+example/a": "foo;bar baz\\qux",
+		"+example/b": "",
+		"+typing":    "active",
+	}
+
+	expected := `@+example/a=foo\:bar\sbaz\\qux;+example/b;+typing=active`
+	if s := formatTags(tags); s != expected {
+		t.Errorf("got %s, expected %s", s, expected)
+	}
+
+	// Make sure that the escaped value is parsed back to the original
+	if v := parseTags(expected[1:])["+example/a"]; v != tags["+example/a"] {
+		t.Errorf("got %s after parsing, expected %s", v, tags["+example/a"])
+	}
+}
+
+// TestSendTagged tests that only client tags are accepted
+func TestSendTagged(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	if err := c.SendTagged(map[string]string{"msgid": "abc"}, "PRIVMSG #foo :bar"); err == nil {
+		t.Errorf("expected an error for a server tag")
+	}
+
+	go c.SendTagged(map[string]string{"+draft/reply": "a;b"}, "PRIVMSG %s :%s", "#foo", "bar")
+	if l, _ := tr.ReadLine(); l != `@+draft/reply=a\:b PRIVMSG #foo :bar` {
+		t.Errorf("unexpected line %s", l)
+	}
+}
+
+// TestTagMsg tests that TAGMSG is sent and that received tags are reported
+func TestTagMsg(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	ch := make(chan map[string]string, 1)
+	c.OnTagMsg(func(from, target string, tags map[string]string) {
+		if from == "bar" && target == "#foo" {
+			ch <- tags
+		}
+	})
+
+	go c.TagMsg("#foo", map[string]string{"+typing": "active"})
+	runScript(t, conn, tr, []string{
+		"CLI @+typing=active TAGMSG #foo",
+		"SRV @+typing=paused;msgid=abc :bar!~bar@127.0.0.1 TAGMSG #foo",
+	})
+
+	select {
+	case tags := <-ch:
+		if tags["+typing"] != "paused" || tags["msgid"] != "abc" {
+			t.Errorf("unexpected tags %v", tags)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("TAGMSG was not reported")
+	}
+}
+
+// TestTyping tests that the typing state is sent and reported, and that
+// unknown states are refused
+func TestTyping(t *testing.T) {
+	c, conn, tr := newTestClient()
+	defer conn.Server.Close()
+
+	ch := make(chan string, 2)
+	c.OnTyping(func(from, target, state string) {
+		ch <- from + " " + target + " " + state
+	})
+
+	if err := c.Typing("#c", "busy"); err == nil {
+		t.Errorf("expected an error for an invalid state")
+	}
+
+	go c.Typing("#c", "active")
+	runScript(t, conn, tr, []string{
+		"CLI @+typing=active TAGMSG #c",
+		"SRV @+draft/react=x :bar!~bar@127.0.0.1 TAGMSG #c",
+		"SRV @+typing=done :bar!~bar@127.0.0.1 TAGMSG #c",
+	})
+
+	select {
+	case s := <-ch:
+		if s != "bar #c done" {
+			t.Errorf("got %q, expected %q", s, "bar #c done")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("typing was not reported")
+	}
+
+	select {
+	case s := <-ch:
+		t.Errorf("unexpected typing %q", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,51 @@
+package irc
+
+import (
+	"time"
+)
+
+// bucket is a token bucket that limits the rate of messages to a target
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// reserveTarget reserves a message to the target and returns how long the
+// caller has to wait before the message can be sent, zero is returned if the
+// rate isn't limited
+func (c *Client) reserveTarget(target string) time.Duration {
+	if c.targetMessages <= 0 || c.targetPer <= 0 {
+		return 0
+	}
+
+	c.infoMu.Lock()
+	key := c.casefold(target)
+	c.infoMu.Unlock()
+
+	c.targetMu.Lock()
+	defer c.targetMu.Unlock()
+
+	now := c.clock.Now()
+	b, ok := c.targetBuckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(c.targetMessages), last: now}
+		c.targetBuckets[key] = b
+	}
+
+	// Refill the bucket with the tokens that have been earned since the
+	// last message, the bucket never holds more than the burst size
+	rate := float64(c.targetMessages) / float64(c.targetPer)
+	b.tokens += float64(now.Sub(b.last)) * rate
+	if b.tokens > float64(c.targetMessages) {
+		b.tokens = float64(c.targetMessages)
+	}
+	b.last = now
+
+	// Take a token, a negative balance means that the message has to
+	// wait until the bucket has been refilled
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate)
+}
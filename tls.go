@@ -0,0 +1,39 @@
+package irc
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// rememberConn remembers how to connect to the server again when we were
+// given a connection with WithConn. The address of a TCP connection is used
+// unless WithAddr or WithConnFactory has been used, and a TLS connection
+// makes the new connections use TLS with the same server name unless a
+// configuration has been set with WithTLS.
+func (c *Client) rememberConn(conn net.Conn) error {
+	if tc, ok := conn.(*tls.Conn); ok {
+		// The server name is known once the handshake is done
+		if err := tc.Handshake(); err != nil {
+			return err
+		}
+		if c.tlsConfig == nil {
+			c.tlsConfig = &tls.Config{ServerName: tc.ConnectionState().ServerName}
+		}
+	}
+
+	if c.addr == "" && c.connFactory == nil {
+		if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			c.addr = addr.String()
+		}
+	}
+	return nil
+}
+
+// dial connects to the address that was set with WithAddr, TLS is used if a
+// configuration is known
+func (c *Client) dial() (net.Conn, error) {
+	if c.tlsConfig != nil {
+		return tls.Dial("tcp", c.addr, c.tlsConfig)
+	}
+	return net.Dial("tcp", c.addr)
+}
@@ -0,0 +1,151 @@
+package irc
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// newTestTLSConfigs returns the TLS configurations of a server with a self
+// signed certificate for localhost and of a client that trusts it
+func newTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	return server, client
+}
+
+// expectRegistration reads the registration of the client from the server
+// side of a connection
+func expectRegistration(t *testing.T, conn net.Conn) {
+	tr := textproto.NewReader(bufio.NewReader(conn))
+	for _, expected := range []string{"CAP LS 302", "USER foo * * :foo", "NICK foo"} {
+		if l, err := tr.ReadLine(); l != expected {
+			t.Fatalf("got %q (%v), expected %q", l, err, expected)
+		}
+	}
+}
+
+// TestTLSConnReconnect tests that a TLS connection that is given with
+// WithConn is replaced by one from the factory when it is lost
+func TestTLSConnReconnect(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	pipe := func() (net.Conn, net.Conn) {
+		client, server := net.Pipe()
+		return tls.Client(client, clientConfig), tls.Server(server, serverConfig)
+	}
+
+	clock := newFakeClock()
+	conn, server := pipe()
+	servers := make(chan net.Conn, 1)
+	c := NewClient(WithClock(clock), WithNick("foo"), WithConn(conn), WithConnFactory(func() (net.Conn, error) {
+		conn, server := pipe()
+		servers <- server
+		return conn, nil
+	}))
+	defer c.Quit("bye")
+
+	go c.Connect()
+	expectRegistration(t, server)
+	server.Close()
+
+	waitForWaiters(t, clock)
+	clock.Advance(5 * time.Second)
+	select {
+	case server = <-servers:
+		defer server.Close()
+		expectRegistration(t, server)
+	case <-time.After(time.Second):
+		t.Fatalf("the client didn't reconnect")
+	}
+}
+
+// TestTLSConnRemember tests that the client reconnects to the address of a
+// TLS connection that is given with WithConn
+func TestTLSConnRemember(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// The server sides of the handshakes are done when the registration is
+	// read, so the connections are accepted in the background
+	servers := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			servers <- conn
+		}
+	}()
+	accept := func() net.Conn {
+		select {
+		case conn := <-servers:
+			return conn
+		case <-time.After(time.Second):
+			t.Fatalf("the client didn't connect")
+		}
+		return nil
+	}
+
+	// The handshake of the first connection is done by Connect
+	tcp, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	c := NewClient(WithClock(clock), WithNick("foo"), WithConn(tls.Client(tcp, clientConfig)), WithTLS(clientConfig))
+	defer c.Quit("bye")
+
+	go c.Connect()
+	server := accept()
+	expectRegistration(t, server)
+	server.Close()
+
+	waitForWaiters(t, clock)
+	clock.Advance(5 * time.Second)
+	server = accept()
+	defer server.Close()
+	expectRegistration(t, server)
+}
@@ -0,0 +1,99 @@
+package irc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// replyTimeout is the maximum time we wait for the server to reply to a
+// request/reply style command.
+const replyTimeout = 30 * time.Second
+
+// waiter is used by request/reply style commands, the read loop passes each
+// message that match accepts to the waiter before it is sent to the hub.
+type waiter struct {
+	match func(m *Message) bool
+	ch    chan *Message
+	done  chan struct{}
+}
+
+// waiters holds all the active waiters of a client
+type waiters struct {
+	list []*waiter
+	mu   sync.Mutex
+}
+
+// wait registers a new waiter that receives all messages that match accepts,
+// the waiter must be released with stopWait when it is no longer used.
+func (c *Client) wait(match func(m *Message) bool) *waiter {
+	w := &waiter{
+		match: match,
+		ch:    make(chan *Message),
+		done:  make(chan struct{}),
+	}
+
+	c.waiters.mu.Lock()
+	c.waiters.list = append(c.waiters.list, w)
+	c.waiters.mu.Unlock()
+
+	return w
+}
+
+// stopWait removes the waiter from the client
+func (c *Client) stopWait(w *waiter) {
+	c.waiters.mu.Lock()
+	for i, ww := range c.waiters.list {
+		if ww == w {
+			c.waiters.list = append(c.waiters.list[:i], c.waiters.list[i+1:]...)
+			break
+		}
+	}
+	c.waiters.mu.Unlock()
+
+	close(w.done)
+}
+
+// notifyWaiters passes the message to all waiters that are interested in it
+func (c *Client) notifyWaiters(m *Message) {
+	// Take a copy of the waiters so that we don't hold the lock while
+	// we are passing the message on.
+	c.waiters.mu.Lock()
+	list := make([]*waiter, len(c.waiters.list))
+	copy(list, c.waiters.list)
+	c.waiters.mu.Unlock()
+
+	for _, w := range list {
+		if !w.match(m) {
+			continue
+		}
+
+		// The waiter might have given up already, so make sure that
+		// we don't block forever in that case.
+		select {
+		case w.ch <- m:
+		case <-w.done:
+		}
+	}
+}
+
+// SendAndWait sends the line to the server and waits until a message that
+// done returns true for is received, the message is returned. An error is
+// returned if no such message is received before the timeout expires.
+func (c *Client) SendAndWait(line string, done func(m *Message) bool, timeout time.Duration) (*Message, error) {
+	// Register the waiter before the line is sent so that we don't miss
+	// the reply
+	w := c.wait(done)
+	defer c.stopWait(w)
+
+	if err := c.SendRaw(line); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m := <-w.ch:
+		return m, nil
+	case <-c.clock.After(timeout):
+		return nil, fmt.Errorf("timeout waiting for reply to %s", line)
+	}
+}
@@ -0,0 +1,76 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Watch asks the server to tell us when the nicks come online or go offline,
+// MONITOR is used if the server advertises it and WATCH is used otherwise.
+// Use OnPresence to receive the notifications.
+func (c *Client) Watch(nicks ...string) error {
+	return c.watch("+", nicks)
+}
+
+// Unwatch stops the notifications for the nicks
+func (c *Client) Unwatch(nicks ...string) error {
+	return c.watch("-", nicks)
+}
+
+// watch adds or removes the nicks from the MONITOR or WATCH list
+func (c *Client) watch(op string, nicks []string) error {
+	if len(nicks) == 0 {
+		return nil
+	}
+
+	c.infoMu.Lock()
+	_, monitor := c.isupport["MONITOR"]
+	_, watch := c.isupport["WATCH"]
+	c.infoMu.Unlock()
+
+	switch {
+	case monitor:
+		// MONITOR +<nick>[,<nick>...]
+		return c.Sendf("MONITOR %s %s", op, strings.Join(nicks, ","))
+	case watch:
+		// WATCH +<nick> [+<nick>...]
+		return c.Sendf("WATCH %s%s", op, strings.Join(nicks, " "+op))
+	}
+
+	return fmt.Errorf("the server supports neither MONITOR nor WATCH")
+}
+
+// OnPresence registers a function that is called when a nick that we watch
+// comes online or goes offline, it is also called with the current state of
+// each nick when it is added with Watch
+func (c *Client) OnPresence(fn func(nick string, online bool)) {
+	// MONITOR replies, <me> :<target>[,<target>...] where the targets
+	// are nick!user@host for 730 and nicks for 731
+	monitor := func(online bool) func(m *Message) {
+		return func(m *Message) {
+			for _, t := range strings.Split(m.Text(), ",") {
+				if i := strings.Index(t, userPrefix); i >= 0 {
+					t = t[:i]
+				}
+				if t != "" {
+					fn(t, online)
+				}
+			}
+		}
+	}
+	c.Handle("730", monitor(true))
+	c.Handle("731", monitor(false))
+
+	// WATCH replies, <me> <nick> <user> <host> <time> :<text>
+	watch := func(online bool) func(m *Message) {
+		return func(m *Message) {
+			if len(m.ParamsArray) > 1 {
+				fn(m.ParamsArray[1], online)
+			}
+		}
+	}
+	c.Handle("600", watch(true))
+	c.Handle("604", watch(true))
+	c.Handle("601", watch(false))
+	c.Handle("605", watch(false))
+}
@@ -0,0 +1,57 @@
+package irc
+
+// write writes the line to the connection, or to the write buffer if
+// buffered writes are enabled. All writes are serialized by writeMu.
+func (c *Client) write(s string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// The connection might have been lost since the caller looked at it
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+
+	if c.flushInterval == 0 {
+		_, err := c.conn.Write([]byte(s))
+		return err
+	}
+
+	// Buffer the line and make sure that it is flushed within the flush
+	// interval
+	c.writeBuf.WriteString(s)
+	if c.flushTimer == nil {
+		c.flushTimer = c.clock.AfterFunc(c.flushInterval, func() { c.Flush() })
+	}
+
+	return nil
+}
+
+// Flush writes all buffered lines to the server, it does nothing unless
+// buffered writes have been enabled with WithBufferedWrites.
+func (c *Client) Flush() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+		c.flushTimer = nil
+	}
+
+	if c.writeBuf.Len() == 0 || c.conn == nil {
+		return nil
+	}
+
+	_, err := c.conn.Write(c.writeBuf.Bytes())
+	c.writeBuf.Reset()
+	return err
+}
+
+// discardWrites drops the buffered lines, they were meant for a connection
+// that is gone. The caller must hold writeMu.
+func (c *Client) discardWrites() {
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+		c.flushTimer = nil
+	}
+	c.writeBuf.Reset()
+}
@@ -0,0 +1,67 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBufferedWrites tests that buffered lines are only written when they
+// are flushed, either by Flush or when the flush interval has passed
+func TestBufferedWrites(t *testing.T) {
+	c, conn, tr := newTestClient(WithBufferedWrites(100 * time.Millisecond))
+	defer conn.Server.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			l, err := tr.ReadLine()
+			if err != nil {
+				return
+			}
+			lines <- l
+		}
+	}()
+
+	expect := func(line string, within time.Duration) {
+		t.Helper()
+		select {
+		case l := <-lines:
+			if l != line {
+				t.Errorf("got %q, expected %q", l, line)
+			}
+		case <-time.After(within):
+			t.Fatalf("%q wasn't written", line)
+		}
+	}
+
+	c.SendRaw("PRIVMSG #foo :one")
+	c.Flush()
+	expect("PRIVMSG #foo :one", 50*time.Millisecond)
+
+	c.SendRaw("PRIVMSG #foo :two")
+	select {
+	case l := <-lines:
+		t.Fatalf("%q was written before it was flushed", l)
+	case <-time.After(20 * time.Millisecond):
+	}
+	expect("PRIVMSG #foo :two", time.Second)
+}
+
+// TestBufferedWritesDiscarded tests that lines that were buffered for a
+// connection that is gone are dropped, and that nothing is written to a
+// connection that has been lost
+func TestBufferedWritesDiscarded(t *testing.T) {
+	conn := newMockComm()
+	c := NewClient(WithConn(conn.Client), WithNick("foo"), WithBufferedWrites(time.Hour))
+
+	c.SendRaw("PRIVMSG #foo :stale")
+	c.resetState()
+	if n := c.writeBuf.Len(); n != 0 {
+		t.Errorf("expected the write buffer to be empty, it has %d bytes", n)
+	}
+
+	c.conn = nil
+	if err := c.write("PRIVMSG #foo :lost\r\n"); err != ErrNotConnected {
+		t.Errorf("got %v, expected %v", err, ErrNotConnected)
+	}
+}